@@ -4,9 +4,13 @@ import (
 	"SpotifySorter/internal/config"
 	userHandlers "SpotifySorter/internal/http-server/handlers/user"
 	jwtMiddleware "SpotifySorter/internal/http-server/middleware/jwt"
+	"SpotifySorter/internal/lib/client/spotify"
+	"SpotifySorter/internal/lib/keyset"
 	"SpotifySorter/internal/lib/logger/handlers/slogpretty"
 	"SpotifySorter/internal/lib/logger/slog"
+	"SpotifySorter/internal/lib/oauth"
 	"SpotifySorter/internal/storage/mysql"
+	"context"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
@@ -52,24 +56,31 @@ func main() {
 		os.Exit(1)
 	}
 
-	logger.Info("Starting application")
-	router := chi.NewRouter()
-	logger.Info("Router created")
+	spotifyAPI := spotify.New(cfg.Spotify.APIURL, cfg.Spotify.AccountsURL, &http.Client{
+		Timeout: cfg.Spotify.Timeout,
+	})
+	spotifyAPI.SetRateLimits(cfg.Spotify.GlobalRate, cfg.Spotify.GlobalBurst, cfg.Spotify.UserRate, cfg.Spotify.UserBurst)
 
-	router.Use(middleware.RequestID)
-	//router.Use(mwLogger.New(logger))
-	router.Use(middleware.Recoverer)
-	router.Use(middleware.URLFormat)
+	loginStates, err := oauth.NewStates(cfg.Spotify.LoginTimeout)
+	if err != nil {
+		logger.Error("failed to init login states", sl.Err(err))
+		os.Exit(1)
+	}
 
-	corsMiddleware(router)
+	keySpecs := make([]keyset.Spec, len(cfg.Auth.Keys))
+	for i, key := range cfg.Auth.Keys {
+		keySpecs[i] = keyset.Spec(key)
+	}
 
-	router.Post("/auth/code", userHandlers.AuthUser(logger, storage))
+	keys, err := keyset.New(cfg.Auth.SigningKey, keySpecs)
+	if err != nil {
+		logger.Error("failed to load JWT keys", sl.Err(err))
+		os.Exit(1)
+	}
 
-	router.Group(func(r chi.Router) {
-		r.Use(jwtMiddleware.JWTMiddleware(os.Getenv("JWT_SECRET"), storage))
-		r.Get("/user/playlist", userHandlers.GetAllPlaylists(logger, storage))
-		r.Get("/user/playlist/{id}", userHandlers.GetPlaylistById(logger, storage))
-	})
+	logger.Info("Starting application")
+	router := newRouter(logger, cfg, storage, spotifyAPI, loginStates, keys)
+	logger.Info("Router created")
 
 	logger.Info("Starting server")
 
@@ -79,12 +90,75 @@ func main() {
 	initServer(cfg, router, logger)
 	logger.Info("server started")
 
+	ctx, cancel := context.WithCancel(context.Background())
+	if cfg.SmartSyncInterval > 0 {
+		go userHandlers.SyncSmartPlaylists(ctx, logger, storage, storage, storage, storage, spotifyAPI, cfg.SmartSyncInterval)
+	}
+
 	<-done
 	logger.Info("stopping server")
+	cancel()
 
 	logger.Info("server stopped")
 }
 
+// newRouter returns the routes of the API. The JWKS is served on its own, as
+// URLFormat would strip its ".json" extension before routing.
+func newRouter(logger *slog.Logger, cfg *config.Config, storage *mysql.Storage, spotifyAPI *spotify.API, loginStates *oauth.States, keys *keyset.Keyset) *chi.Mux {
+	router := chi.NewRouter()
+
+	router.Use(middleware.RequestID)
+	//router.Use(mwLogger.New(logger))
+	router.Use(middleware.Recoverer)
+
+	corsMiddleware(router)
+
+	router.Get("/.well-known/jwks.json", userHandlers.JWKS(keys))
+
+	api := chi.NewRouter()
+	api.Use(middleware.URLFormat)
+
+	api.Get("/auth/login", userHandlers.Login(logger, loginStates, spotifyAPI))
+	tokenIssuer := userHandlers.TokenIssuer{
+		Signer:     keys,
+		AccessTTL:  cfg.Auth.AccessTokenTTL,
+		RefreshTTL: cfg.Auth.RefreshTokenTTL,
+	}
+
+	api.Post("/auth/code", userHandlers.AuthUser(logger, storage, storage, storage, loginStates, tokenIssuer, spotifyAPI))
+	api.Post("/auth/refresh", userHandlers.RefreshAccessToken(logger, storage, storage, tokenIssuer))
+
+	api.Group(func(r chi.Router) {
+		r.Use(jwtMiddleware.JWTMiddleware(keys, storage, storage))
+		r.Post("/auth/logout", userHandlers.Logout(logger, storage))
+		r.Get("/user/sessions", userHandlers.GetSessions(logger, storage))
+		r.Delete("/user/sessions/{id}", userHandlers.DeleteSession(logger, storage))
+		r.Get("/user/playlist", userHandlers.GetAllPlaylists(logger, storage, spotifyAPI))
+		r.Post("/user/playlist/merge", userHandlers.MergePlaylists(logger, storage, storage, spotifyAPI))
+		r.Get("/user/playlist/{id}", userHandlers.GetPlaylistById(logger, storage, spotifyAPI))
+		r.Post("/user/playlist/{id}/sort", userHandlers.SortPlaylist(logger, storage, storage, spotifyAPI))
+		r.Post("/user/playlist/{id}/sort/preview", userHandlers.PreviewSortPlaylist(logger, storage, spotifyAPI))
+		r.Post("/user/playlist/{id}/sort-by-features", userHandlers.SortPlaylistByFeatures(logger, storage, storage, storage, spotifyAPI))
+		r.Post("/user/playlist/{id}/harmonic-order", userHandlers.HarmonicOrderPlaylist(logger, storage, storage, storage, spotifyAPI))
+		r.Post("/user/playlist/{id}/shuffle", userHandlers.ShufflePlaylist(logger, storage, storage, spotifyAPI))
+		r.Get("/user/playlist/{id}/duplicates", userHandlers.FindDuplicates(logger, storage, spotifyAPI))
+		r.Post("/user/playlist/{id}/dedupe", userHandlers.DedupePlaylist(logger, storage, storage, spotifyAPI))
+		r.Post("/user/playlist/{id}/split", userHandlers.SplitPlaylist(logger, storage, spotifyAPI))
+		r.Get("/user/smart-playlists", userHandlers.GetSmartPlaylists(logger, storage))
+		r.Post("/user/smart-playlists", userHandlers.CreateSmartPlaylist(logger, storage))
+		r.Get("/user/smart-playlists/{id}", userHandlers.GetSmartPlaylist(logger, storage))
+		r.Put("/user/smart-playlists/{id}", userHandlers.UpdateSmartPlaylist(logger, storage))
+		r.Delete("/user/smart-playlists/{id}", userHandlers.DeleteSmartPlaylist(logger, storage))
+		r.Post("/user/smart-playlists/{id}/sync", userHandlers.SyncSmartPlaylist(logger, storage, storage, storage, storage, spotifyAPI))
+		r.Get("/user/playlist/{id}/snapshots", userHandlers.GetPlaylistSnapshots(logger, storage))
+		r.Post("/user/playlist/{id}/snapshots/{snap}/restore", userHandlers.RestorePlaylistSnapshot(logger, storage, storage, spotifyAPI))
+	})
+
+	router.Mount("/", api)
+
+	return router
+}
+
 func setupLogger(env string) *slog.Logger {
 	var logger *slog.Logger
 
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"SpotifySorter/internal/config"
+	"SpotifySorter/internal/lib/client/spotify"
+	"SpotifySorter/internal/lib/keyset"
+	"SpotifySorter/internal/lib/oauth"
+	"SpotifySorter/internal/storage/mysql"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testRouter returns the router with an EdDSA signing key and a storage that
+// is never connected, so only routes that answer before touching the
+// database can be requested.
+func testRouter(t *testing.T) http.Handler {
+	t.Helper()
+
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "ed25519.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	keys, err := keyset.New("ed", []keyset.Spec{{Id: "ed", Algorithm: keyset.AlgorithmEdDSA, PrivateKey: path}})
+	if err != nil {
+		t.Fatalf("keyset.New: %v", err)
+	}
+
+	states, err := oauth.NewStates(time.Minute)
+	if err != nil {
+		t.Fatalf("NewStates: %v", err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	api := spotify.New("http://localhost/v1/", "http://localhost/", http.DefaultClient)
+
+	return newRouter(logger, &config.Config{}, &mysql.Storage{}, api, states, keys)
+}
+
+func TestJWKSRoute(t *testing.T) {
+	router := testRouter(t)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /.well-known/jwks.json returned %d, want 200", rec.Code)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+	if got := rec.Header().Get("Cache-Control"); got != "public, max-age=300" {
+		t.Errorf("Cache-Control = %q, want the keys cached for 5 minutes", got)
+	}
+
+	var set keyset.JWKS
+	if err := json.Unmarshal(rec.Body.Bytes(), &set); err != nil {
+		t.Fatalf("decoding the JWKS: %v", err)
+	}
+	if len(set.Keys) != 1 || set.Keys[0].Kid != "ed" || set.Keys[0].Kty != "OKP" {
+		t.Errorf("JWKS = %+v, want the Ed25519 key ed", set)
+	}
+}
+
+func TestURLFormat(t *testing.T) {
+	router := testRouter(t)
+
+	// The API routes still accept a format extension. The JWT middleware
+	// rejects the malformed header, which shows the route was found.
+	for _, path := range []string{"/user/playlist", "/user/playlist.json"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Basic x")
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("GET %s returned %d, want 401", path, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+// Command spotifytest runs the fake Spotify of package spotifytest with a demo
+// user and a few playlists, so that the backend and the frontend can be run
+// without a Spotify account. Point the backend at it with
+//
+//	spotify:
+//	  api_url: "http://localhost:8081/v1/"
+//	  accounts_url: "http://localhost:8081/"
+//
+// Logging in at /auth/login then signs in as the demo user without asking.
+package main
+
+import (
+	"SpotifySorter/internal/lib/client/spotify/spotifytest"
+	userModel "SpotifySorter/models"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+const demoUser = "demo"
+
+func main() {
+	addr := flag.String("addr", "localhost:8081", "address to listen on")
+	tracks := flag.Int("tracks", 500, "number of tracks in the largest demo playlist")
+	flag.Parse()
+
+	server, err := spotifytest.Listen(*addr)
+	if err != nil {
+		log.Fatalf("failed to start fake Spotify: %s", err)
+	}
+	defer server.Close()
+
+	seed(server, *tracks)
+
+	log.Printf("fake Spotify listening on %s", server.URL)
+	log.Printf("api_url: %s", server.APIURL())
+	log.Printf("accounts_url: %s", server.AccountsURL())
+
+	done := make(chan os.Signal, 1)
+	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+	<-done
+}
+
+// seed adds the demo user, n generated tracks with audio features and
+// playlists to sort, dedupe and split.
+func seed(server *spotifytest.Server, n int) {
+	server.AddUser(spotifytest.User{
+		Id:          demoUser,
+		DisplayName: "Demo User",
+		Email:       "demo@example.com",
+		Country:     "US",
+		Product:     "premium",
+	})
+	server.SetLoginUser(demoUser)
+
+	rng := rand.New(rand.NewPCG(1, 2))
+
+	artists := []string{"The Beatles", "Daft Punk", "Nina Simone", "Radiohead", "Aretha Franklin", "Kraftwerk", "Björk", "Miles Davis"}
+
+	tracks := make([]userModel.Track, n)
+	for i := range tracks {
+		track := &tracks[i]
+		track.Name = fmt.Sprintf("Track %03d", i+1)
+		track.Artists = []userModel.Artist{{Name: artists[rng.IntN(len(artists))]}}
+		track.Album.Name = fmt.Sprintf("Album %02d", rng.IntN(40)+1)
+		track.Album.ReleaseDate = fmt.Sprintf("%d-%02d-%02d", 1960+rng.IntN(65), rng.IntN(12)+1, rng.IntN(28)+1)
+		track.Album.ReleaseDatePrecision = "day"
+		track.DurationMs = 120000 + rng.IntN(300000)
+		track.Popularity = rng.IntN(101)
+		track.DiscNumber = 1
+		track.TrackNumber = rng.IntN(12) + 1
+		track.ExternalIds.Isrc = fmt.Sprintf("USDEMO%06d", i+1)
+	}
+	tracks = server.AddTracks(tracks...)
+
+	uris := make([]string, len(tracks))
+	for i, track := range tracks {
+		uris[i] = track.Uri
+
+		server.AddAudioFeatures(userModel.AudioFeatures{
+			Id:               track.Id,
+			Acousticness:     rng.Float64(),
+			Danceability:     rng.Float64(),
+			Energy:           rng.Float64(),
+			Instrumentalness: rng.Float64(),
+			Key:              rng.IntN(12),
+			Liveness:         rng.Float64(),
+			Loudness:         -20 + rng.Float64()*20,
+			Mode:             rng.IntN(2),
+			Speechiness:      rng.Float64(),
+			Tempo:            70 + rng.Float64()*110,
+			TimeSignature:    4,
+			Valence:          rng.Float64(),
+		})
+	}
+
+	rng.Shuffle(len(uris), func(i, j int) { uris[i], uris[j] = uris[j], uris[i] })
+
+	server.AddPlaylist(demoUser, "Everything", uris...)
+	server.AddPlaylist(demoUser, "Small", uris[:min(20, len(uris))]...)
+
+	var dupes []string
+	for _, uri := range uris[:min(30, len(uris))] {
+		dupes = append(dupes, uri)
+		if rng.IntN(3) == 0 {
+			dupes = append(dupes, uri)
+		}
+	}
+	server.AddPlaylist(demoUser, "With duplicates", dupes...)
+
+	server.SaveTracks(demoUser, uris[:min(50, len(uris))]...)
+}
@@ -1,7 +1,10 @@
 package response
 
 import (
+	"SpotifySorter/internal/lib/client/spotify"
+	"errors"
 	"fmt"
+	"net/http"
 	"strings"
 
 	"github.com/go-playground/validator/v10"
@@ -16,6 +19,9 @@ const (
 	StatusOK           = "OK"
 	StatusError        = "Error"
 	StatusUnauthorized = "Unauthorized"
+	StatusForbidden    = "Forbidden"
+	StatusNotFound     = "NotFound"
+	StatusRateLimited  = "RateLimited"
 )
 
 func OK() Response {
@@ -38,6 +44,57 @@ func Unauthorized(msg string) Response {
 	}
 }
 
+func Forbidden(msg string) Response {
+	return Response{
+		Status: StatusForbidden,
+		Error:  msg,
+	}
+}
+
+func NotFound(msg string) Response {
+	return Response{
+		Status: StatusNotFound,
+		Error:  msg,
+	}
+}
+
+func RateLimited(msg string) Response {
+	return Response{
+		Status: StatusRateLimited,
+		Error:  msg,
+	}
+}
+
+// SpotifyError picks the HTTP status and response for an error returned by
+// the Spotify client. msg describes the operation that failed.
+func SpotifyError(err error, msg string) (int, Response) {
+	var rateLimited *spotify.ErrRateLimited
+	var apiErr *spotify.APIError
+
+	switch {
+	case errors.Is(err, spotify.ErrUnauthorized):
+		return http.StatusUnauthorized, Unauthorized("spotify authorization expired or was revoked")
+	case errors.Is(err, spotify.ErrForbidden):
+		return http.StatusForbidden, Forbidden(msg + ": access denied by Spotify")
+	case errors.Is(err, spotify.ErrNotFound):
+		return http.StatusNotFound, NotFound(msg + ": not found on Spotify")
+	case errors.Is(err, spotify.ErrPlaylistChanged):
+		return http.StatusConflict, Error(msg + ": the playlist is being changed, try again later")
+	case errors.As(err, &rateLimited):
+		return http.StatusTooManyRequests, RateLimited(msg + ": rate limited by Spotify")
+	case errors.As(err, &apiErr):
+		if apiErr.Status >= 500 {
+			return http.StatusBadGateway, Error(msg + ": Spotify is unavailable")
+		}
+		if apiErr.Message != "" {
+			return http.StatusBadRequest, Error(msg + ": " + apiErr.Message)
+		}
+		return http.StatusBadRequest, Error(msg)
+	}
+
+	return http.StatusInternalServerError, Error(msg)
+}
+
 func ValidationError(errs validator.ValidationErrors) Response {
 	var errMsgs []string
 
@@ -12,6 +12,11 @@ type Config struct {
 	Env        string `yaml:"env" env-default:"local"`
 	HTTPServer `yaml:"http_server"`
 	Database   `yaml:"database"`
+	Spotify    `yaml:"spotify"`
+	Auth       `yaml:"auth"`
+	// SmartSyncInterval is how often smart playlists are synced in the
+	// background; 0 disables background syncing.
+	SmartSyncInterval time.Duration `yaml:"smart_sync_interval" env-default:"1h"`
 }
 
 type Database struct {
@@ -22,6 +27,45 @@ type Database struct {
 	Database string `yaml:"database" env-required:"true"`
 }
 
+type Spotify struct {
+	APIURL      string        `yaml:"api_url" env-default:"https://api.spotify.com/v1/"`
+	AccountsURL string        `yaml:"accounts_url" env-default:"https://accounts.spotify.com/"`
+	Timeout     time.Duration `yaml:"timeout" env-default:"30s"`
+	// LoginTimeout is how long a login started at /auth/login may take.
+	LoginTimeout time.Duration `yaml:"login_timeout" env-default:"10m"`
+	// GlobalRate and UserRate are the requests per second sent to the Web
+	// API by the whole backend and on behalf of a single user.
+	GlobalRate  float64 `yaml:"global_rate" env-default:"20"`
+	GlobalBurst int     `yaml:"global_burst" env-default:"40"`
+	UserRate    float64 `yaml:"user_rate" env-default:"10"`
+	UserBurst   int     `yaml:"user_burst" env-default:"20"`
+}
+
+// Auth configures the tokens issued to API clients.
+type Auth struct {
+	AccessTokenTTL  time.Duration `yaml:"access_token_ttl" env-default:"15m"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl" env-default:"720h"`
+	// SigningKey is the id of the key in Keys that signs new tokens. The
+	// other keys only verify tokens signed before a rotation.
+	SigningKey string   `yaml:"signing_key"`
+	Keys       []JWTKey `yaml:"keys"`
+}
+
+// JWTKey is a key of the access token keyset. HS256 keys read their secret
+// from the environment variable SecretEnv; RS256 and EdDSA keys are PEM
+// files, and a key without PrivateKey can only verify.
+type JWTKey struct {
+	Id         string `yaml:"id"`
+	Algorithm  string `yaml:"algorithm"`
+	SecretEnv  string `yaml:"secret_env"`
+	PrivateKey string `yaml:"private_key"`
+	PublicKey  string `yaml:"public_key"`
+}
+
+// defaultJWTKey keeps configs without keys working with the JWT_SECRET
+// environment variable.
+var defaultJWTKey = JWTKey{Id: "default", Algorithm: "HS256", SecretEnv: "JWT_SECRET"}
+
 type HTTPServer struct {
 	Address     string        `yaml:"address" env-default:"localhost:8080"`
 	Timeout     time.Duration `yaml:"timeout" env-default:"4s"`
@@ -44,5 +88,12 @@ func MustLoad() *Config {
 		log.Fatalf("cannot read config: %s", err)
 	}
 
+	if len(cfg.Auth.Keys) == 0 {
+		cfg.Auth.Keys = []JWTKey{defaultJWTKey}
+		if cfg.Auth.SigningKey == "" {
+			cfg.Auth.SigningKey = defaultJWTKey.Id
+		}
+	}
+
 	return &cfg
 }
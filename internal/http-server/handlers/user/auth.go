@@ -4,33 +4,72 @@ import (
 	resp "SpotifySorter/internal/api/response"
 	"SpotifySorter/internal/lib/client/spotify"
 	sl "SpotifySorter/internal/lib/logger/slog"
+	"SpotifySorter/internal/lib/oauth"
 	userModel "SpotifySorter/models"
+	"context"
 	"database/sql"
-	"encoding/base64"
-	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/go-chi/render"
 	"github.com/go-playground/validator/v10"
 	"github.com/golang-jwt/jwt/v4"
 	"log/slog"
 	"net/http"
-	"net/url"
-	"os"
-	"strings"
+	"strconv"
 	"time"
 )
 
 type User interface {
-	SaveUser(email, accessToken, spotifyAccessToken, country, name, idSpotify, product string) (*userModel.User, error)
+	SaveUser(email, spotifyAccessToken, country, name, idSpotify, product string) (*userModel.User, error)
 	GetUserByEmail(email string) (*userModel.User, error)
 	UpdateUser(email, spotifyAccessToken, country, name, idSpotify, product string) (*userModel.User, error)
-	UpdateAccessTokenUser(accessToken string, userModel *userModel.User) (*userModel.User, error)
+	UpdateSpotifyTokens(userId int64, accessToken, refreshToken string, expiresAt time.Time) error
 }
 
-func AuthUser(log *slog.Logger, user User) http.HandlerFunc {
+// LoginStates issues and verifies the state of OAuth logins together with
+// their PKCE code verifiers.
+type LoginStates interface {
+	Issue() (string, string, error)
+	Verify(state, binding string) (string, error)
+}
+
+// loginCookie holds the binding of the login started by the browser. The
+// frontend must send it to /auth/code, i.e. fetch with credentials.
+const loginCookie = "login_binding"
+
+// Login starts the authorization code flow by redirecting to Spotify's
+// authorize page with a fresh state and PKCE challenge. The state is bound
+// to the browser with a cookie, checked and cleared by AuthUser.
+func Login(log *slog.Logger, states LoginStates, api *spotify.API) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.user.Login"
+		log := log.With(slog.String("op", op))
+
+		state, challenge, err := states.Issue()
+		if err != nil {
+			log.Error("failed to issue login state", sl.Err(err))
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("failed to start login"))
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     loginCookie,
+			Value:    oauth.Binding(state),
+			Path:     "/auth",
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+
+		http.Redirect(w, r, api.AuthorizeURL(state, challenge), http.StatusFound)
+	}
+}
+
+func AuthUser(log *slog.Logger, user User, sessions Sessions, refreshTokens RefreshTokens, states LoginStates, issuer TokenIssuer, api *spotify.API) http.HandlerFunc {
 	type Request struct {
 		Code  string `json:"code" validate:"required"`
-		State string `json:"state"`
+		State string `json:"state" validate:"required"`
 	}
 	type Response struct {
 		resp.Response
@@ -39,7 +78,7 @@ func AuthUser(log *slog.Logger, user User) http.HandlerFunc {
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "handlers.user.AuthUser"
-		log = log.With(slog.String("op", op))
+		log := log.With(slog.String("op", op))
 
 		var req Request
 		err := render.DecodeJSON(r.Body, &req)
@@ -55,17 +94,41 @@ func AuthUser(log *slog.Logger, user User) http.HandlerFunc {
 			return
 		}
 
-		accessCredentials, err := sendCode(log, req.Code)
+		// The state proves the login was started by Login, the cookie that
+		// this browser started it, and the verifier that the code was issued
+		// for that login.
+		var binding string
+		if cookie, err := r.Cookie(loginCookie); err == nil {
+			binding = cookie.Value
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     loginCookie,
+			Path:     "/auth",
+			MaxAge:   -1,
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+
+		verifier, err := states.Verify(req.State, binding)
+		if err != nil {
+			log.Error("invalid login state", sl.Err(err))
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("invalid or expired state"))
+			return
+		}
+
+		accessCredentials, err := api.ExchangeCode(r.Context(), log, req.Code, verifier)
 		if err != nil {
 			log.Error("failed to send code user", sl.Err(err))
-			render.JSON(w, r, resp.Error("failed to send code user"))
+			renderSpotifyError(w, r, err, "failed to send code user")
 			return
 		}
 
-		userData, err := getUserData(log, accessCredentials)
+		userData, err := getUserData(r.Context(), log, api, accessCredentials)
 		if err != nil {
 			log.Error("failed to get user data", sl.Err(err))
-			render.JSON(w, r, resp.Error("failed to get user data"))
+			renderSpotifyError(w, r, err, "failed to get user data")
 			return
 		}
 
@@ -74,14 +137,7 @@ func AuthUser(log *slog.Logger, user User) http.HandlerFunc {
 		if err != nil {
 			if errors.Is(err, sql.ErrNoRows) {
 				// Если пользователь не найден, создаем нового
-				token, err := GenerateToken()
-				if err != nil {
-					log.Error("failed to generate JWT", sl.Err(err))
-					render.JSON(w, r, resp.Error("failed to generate JWT"))
-					return
-				}
-
-				savedUser, err = user.SaveUser(userData.Email, token, accessCredentials.AccessToken, userData.Country, userData.Name, userData.IdSpotify, userData.Product)
+				savedUser, err = user.SaveUser(userData.Email, accessCredentials.AccessToken, userData.Country, userData.Name, userData.IdSpotify, userData.Product)
 				if err != nil {
 					log.Error("failed to save user", sl.Err(err))
 					render.JSON(w, r, resp.Error("failed to save user"))
@@ -93,101 +149,77 @@ func AuthUser(log *slog.Logger, user User) http.HandlerFunc {
 				return
 			}
 		} else {
-			_, err = user.UpdateUser(userData.Email, accessCredentials.AccessToken, userData.Country, userData.Name, userData.IdSpotify, userData.Product)
+			savedUser, err = user.UpdateUser(userData.Email, accessCredentials.AccessToken, userData.Country, userData.Name, userData.IdSpotify, userData.Product)
 			if err != nil {
 				log.Error("failed to update user", sl.Err(err))
 				render.JSON(w, r, resp.Error("failed to update user"))
 				return
 			}
-			token, err := GenerateToken()
-			if err != nil {
-				log.Error("failed to generate JWT", sl.Err(err))
-				render.JSON(w, r, resp.Error("failed to generate JWT"))
-				return
-			}
-			savedUser, err = user.UpdateAccessTokenUser(token, savedUser)
-			if err != nil {
-				log.Error("failed to update access token user", sl.Err(err))
-				render.JSON(w, r, resp.Error("failed to update access token user"))
-				return
-			}
+		}
+
+		expiresAt := time.Now().Add(time.Duration(accessCredentials.ExpiresIn) * time.Second)
+		err = user.UpdateSpotifyTokens(savedUser.Id, accessCredentials.AccessToken, accessCredentials.RefreshToken, expiresAt)
+		if err != nil {
+			log.Error("failed to save spotify tokens", sl.Err(err))
+			render.JSON(w, r, resp.Error("failed to save spotify tokens"))
+			return
+		}
+
+		// Every login starts its own session, so logging in on one device
+		// leaves the sessions of the others valid.
+		tokens, err := startSession(sessions, refreshTokens, r, savedUser.Id, issuer)
+		if err != nil {
+			log.Error("failed to issue tokens", sl.Err(err))
+			render.JSON(w, r, resp.Error("failed to generate JWT"))
+			return
 		}
 
 		render.JSON(w, r, Response{
 			Response: resp.OK(),
 			User: userModel.Response{
-				Name:        savedUser.Name,
-				AccessToken: savedUser.AccessToken,
-				Email:       savedUser.Email,
-				IdSpotify:   savedUser.IdSpotify,
+				Name:         savedUser.Name,
+				AccessToken:  tokens.AccessToken,
+				RefreshToken: tokens.RefreshToken,
+				ExpiresIn:    tokens.ExpiresIn,
+				Email:        savedUser.Email,
+				IdSpotify:    savedUser.IdSpotify,
 			},
 		})
 	}
 }
 
-func sendCode(log *slog.Logger, code string) (*userModel.AccessTokensByCode, error) {
-	data := url.Values{}
-	data.Set("code", code)
-	data.Set("redirect_uri", os.Getenv("SPOTIFY_REDIRECT_URI"))
-	data.Set("grant_type", "authorization_code")
+func getUserData(ctx context.Context, log *slog.Logger, api *spotify.API, accessCredentials *userModel.AccessTokensByCode) (*userModel.User, error) {
+	client := api.NewClient(ctx, log, &userModel.User{SpotifyAccessToken: accessCredentials.AccessToken}, nil)
 
-	reqToSpotify, err := http.NewRequest("POST", "https://accounts.spotify.com/api/token", strings.NewReader(data.Encode()))
+	user, err := client.CurrentUser()
 	if err != nil {
-		log.Error("failed to create request", sl.Err(err))
-		return nil, errors.New("failed to create request")
-	}
-
-	clientID := os.Getenv("SPOTIFY_CLIENT_ID")
-	clientSecret := os.Getenv("SPOTIFY_CLIENT_SECRET")
-	if clientID == "" || clientSecret == "" {
-		log.Error("SPOTIFY_CLIENT_ID or SPOTIFY_CLIENT_SECRET is not set")
-		return nil, errors.New("SPOTIFY_CLIENT_ID or SPOTIFY_CLIENT_SECRET is not set")
-	}
-	auth := clientID + ":" + clientSecret
-	encodedAuth := base64.StdEncoding.EncodeToString([]byte(auth))
-	reqToSpotify.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	reqToSpotify.Header.Set("Authorization", "Basic "+encodedAuth)
-
-	client := &http.Client{}
-	resp, err := client.Do(reqToSpotify)
-	if err != nil {
-		log.Error("failed to send request to Spotify", sl.Err(err))
-		return nil, errors.New("failed to send request to Spotify")
-	}
-	defer resp.Body.Close()
-
-	var userData userModel.AccessTokensByCode
-	if err := json.NewDecoder(resp.Body).Decode(&userData); err != nil {
-		log.Error("failed to decode response from Spotify", sl.Err(err))
-		return nil, errors.New("failed to decode response from Spotify")
+		log.Error("failed to get response from Spotify", sl.Err(err))
+		return nil, fmt.Errorf("failed to get response from Spotify: %w", err)
 	}
 
-	return &userData, nil
+	return user, nil
 }
 
-func getUserData(log *slog.Logger, accessCredentials *userModel.AccessTokensByCode) (*userModel.User, error) {
-	response, err := spotify.GetRequest(log, accessCredentials.AccessToken, "me")
+// GenerateToken issues an access token of the user's session valid for ttl.
+// Its subject is the user id and its random ID (jti) tells apart tokens.
+func GenerateToken(signer TokenSigner, userId int64, sessionId string, ttl time.Duration) (string, error) {
+	jti, err := randomToken(16)
 	if err != nil {
-		log.Error("failed to get response from Spotify", sl.Err(err))
-		return nil, errors.New("failed to get response from Spotify")
-	}
-
-	var user userModel.User
-	if err := json.Unmarshal(response, &user); err != nil {
-		log.Error("failed to decode response", sl.Err(err))
-		return nil, errors.New("failed to decode response from Spotify")
+		return "", err
 	}
 
-	return &user, nil
-}
-
-func GenerateToken() (string, error) {
+	now := time.Now()
 	claims := userModel.Claims{
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(72 * time.Hour)),
+			Subject:   strconv.FormatInt(userId, 10),
+			Issuer:    userModel.TokenIssuer,
+			Audience:  jwt.ClaimStrings{userModel.TokenAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			ID:        jti,
 		},
+		SessionId: sessionId,
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	return signer.Sign(claims)
 }
@@ -0,0 +1,286 @@
+package user
+
+import (
+	resp "SpotifySorter/internal/api/response"
+	jwtMiddleware "SpotifySorter/internal/http-server/middleware/jwt"
+	"SpotifySorter/internal/lib/client/spotify"
+	"SpotifySorter/internal/lib/duplicates"
+	sl "SpotifySorter/internal/lib/logger/slog"
+	userModel "SpotifySorter/models"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+type duplicateTrack struct {
+	Position   int    `json:"position"`
+	Uri        string `json:"uri"`
+	Name       string `json:"name"`
+	Artist     string `json:"artist"`
+	Album      string `json:"album"`
+	AddedAt    string `json:"added_at"`
+	Popularity int    `json:"popularity"`
+}
+
+type duplicateGroup struct {
+	Rule   duplicates.Rule  `json:"rule"`
+	Tracks []duplicateTrack `json:"tracks"`
+}
+
+// FindDuplicates lists groups of playlist items holding the same song. The
+// rules query parameter, e.g. "track_id,isrc", limits the rules used.
+func FindDuplicates(log *slog.Logger, user User, api *spotify.API) http.HandlerFunc {
+	type Response struct {
+		resp.Response
+		Groups []duplicateGroup `json:"groups"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.duplicates.FindDuplicates"
+		log := log.With(slog.String("op", op))
+
+		userData := jwtMiddleware.GetUserFromContext(r.Context())
+		if userData == nil {
+			http.Error(w, "User not found", http.StatusUnauthorized)
+			return
+		}
+
+		rules := duplicates.Rules
+		if query := r.URL.Query().Get("rules"); query != "" {
+			rules = nil
+			for _, rule := range strings.Split(query, ",") {
+				rules = append(rules, duplicates.Rule(strings.TrimSpace(rule)))
+			}
+		}
+
+		id := chi.URLParam(r, "id")
+		client := api.NewClient(r.Context(), log, userData, user)
+
+		items, err := client.PlaylistItems(id)
+		if err != nil {
+			log.Error("failed to get playlist items", sl.Err(err))
+			renderSpotifyError(w, r, err, "failed to get playlist items")
+			return
+		}
+
+		groups, err := duplicates.Find(items, rules)
+		if err != nil {
+			log.Error("failed to find duplicates", sl.Err(err))
+			render.JSON(w, r, resp.Error(err.Error()))
+			return
+		}
+
+		render.JSON(w, r, Response{
+			Response: resp.OK(),
+			Groups:   duplicateGroups(items, groups),
+		})
+	}
+}
+
+// DedupePlaylist removes all but one item of every duplicate group, chosen by
+// the keeper rule. The playlist is snapshotted first. Kept copies of a
+// removed track are added back, which resets their added_at and added_by;
+// the response reports how many were re-added.
+func DedupePlaylist(log *slog.Logger, user User, snapshot Snapshot, api *spotify.API) http.HandlerFunc {
+	type Request struct {
+		Rules   []string `json:"rules" validate:"omitempty,dive,oneof=track_id isrc title_artist"`
+		Keeper  string   `json:"keeper" validate:"required,oneof=earliest_added most_popular explicit"`
+		Keepers []int    `json:"keepers" validate:"required_if=Keeper explicit,dive,min=0"`
+	}
+	type Response struct {
+		resp.Response
+		SnapshotId string           `json:"snapshot_id"`
+		BackupId   int64            `json:"backup_id"`
+		Removed    int              `json:"removed"`
+		Reinserted int              `json:"reinserted"`
+		Groups     []duplicateGroup `json:"groups"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.duplicates.DedupePlaylist"
+		log := log.With(slog.String("op", op))
+
+		userData := jwtMiddleware.GetUserFromContext(r.Context())
+		if userData == nil {
+			http.Error(w, "User not found", http.StatusUnauthorized)
+			return
+		}
+
+		var req Request
+		if err := render.DecodeJSON(r.Body, &req); err != nil {
+			log.Error("failed to decode request", sl.Err(err))
+			render.JSON(w, r, resp.Error("failed to decode request"))
+			return
+		}
+
+		if err := validator.New().Struct(req); err != nil {
+			log.Error("invalid request", sl.Err(err))
+			render.JSON(w, r, resp.ValidationError(err.(validator.ValidationErrors)))
+			return
+		}
+
+		rules := duplicates.Rules
+		if len(req.Rules) > 0 {
+			rules = make([]duplicates.Rule, len(req.Rules))
+			for i, rule := range req.Rules {
+				rules[i] = duplicates.Rule(rule)
+			}
+		}
+
+		id := chi.URLParam(r, "id")
+		client := api.NewClient(r.Context(), log, userData, user)
+
+		items, version, err := client.PlaylistItemsAt(id)
+		if err != nil {
+			log.Error("failed to get playlist items", sl.Err(err))
+			renderSpotifyError(w, r, err, "failed to get playlist items")
+			return
+		}
+
+		groups, err := duplicates.Find(items, rules)
+		if err != nil {
+			log.Error("failed to find duplicates", sl.Err(err))
+			render.JSON(w, r, resp.Error(err.Error()))
+			return
+		}
+
+		remove, err := duplicates.Remove(items, groups, duplicates.Keeper(req.Keeper), req.Keepers)
+		if err != nil {
+			log.Error("failed to choose keepers", sl.Err(err))
+			render.JSON(w, r, resp.Error(err.Error()))
+			return
+		}
+
+		backup, err := snapshotPlaylist(snapshot, userData.Id, id, version, items)
+		if err != nil {
+			log.Error("failed to snapshot playlist", sl.Err(err))
+			renderSpotifyError(w, r, err, "failed to snapshot playlist")
+			return
+		}
+
+		snapshotId, removed, reinserted := backup.SnapshotId, 0, 0
+		if len(remove) > 0 {
+			snapshotId, removed, reinserted, err = removePositions(client, id, snapshotId, items, remove)
+			if err != nil {
+				log.Error("failed to remove duplicates", sl.Err(err))
+				renderSpotifyError(w, r, err, "failed to remove duplicates")
+				return
+			}
+		}
+
+		render.JSON(w, r, Response{
+			Response:   resp.OK(),
+			SnapshotId: snapshotId,
+			BackupId:   backup.Id,
+			Removed:    removed,
+			Reinserted: reinserted,
+			Groups:     duplicateGroups(items, groups),
+		})
+	}
+}
+
+// removePositions removes the items at the given positions. The Web API
+// only documents removal by URI, which drops every occurrence, so the copies
+// of a removed URI that are kept are inserted back at their positions
+// afterwards. Spotify records those as newly added, with the current user
+// and time as added_by and added_at. Local files cannot be inserted back, so
+// a local file that is also kept elsewhere stays. It returns the final
+// snapshot id, the number of items removed and the number inserted back.
+func removePositions(client *spotify.Client, playlistId, snapshotId string, items []userModel.PlaylistItem, positions []int) (string, int, int, error) {
+	removed := make(map[int]bool, len(positions))
+	for _, position := range positions {
+		removed[position] = true
+	}
+
+	keptUris := make(map[string]bool, len(items))
+	for i, item := range items {
+		if !removed[i] {
+			keptUris[item.Track.Uri] = true
+		}
+	}
+
+	var uris []string
+	seen := make(map[string]bool, len(positions))
+	for i := range items {
+		uri := items[i].Track.Uri
+		if !removed[i] {
+			continue
+		}
+		if keptUris[uri] && !addable(uri) {
+			delete(removed, i)
+			continue
+		}
+		if !seen[uri] {
+			seen[uri] = true
+			uris = append(uris, uri)
+		}
+	}
+
+	if len(uris) == 0 {
+		return snapshotId, 0, 0, nil
+	}
+
+	snapshotId, err := client.RemoveItems(playlistId, uris, snapshotId)
+	if err != nil {
+		return "", 0, 0, err
+	}
+
+	// Kept copies are inserted in playlist order, so every item in front of
+	// one is already back in place when it is inserted. Runs of adjacent
+	// copies are inserted with one call.
+	var run []string
+	runStart, position, reinserted := 0, 0, 0
+	for i, item := range items {
+		if removed[i] {
+			continue
+		}
+
+		if seen[item.Track.Uri] {
+			if len(run) == 0 {
+				runStart = position
+			}
+			run = append(run, item.Track.Uri)
+		} else if len(run) > 0 {
+			if snapshotId, err = client.AddItems(playlistId, run, runStart); err != nil {
+				return "", 0, 0, err
+			}
+			reinserted += len(run)
+			run = nil
+		}
+		position++
+	}
+
+	if len(run) > 0 {
+		if snapshotId, err = client.AddItems(playlistId, run, runStart); err != nil {
+			return "", 0, 0, err
+		}
+		reinserted += len(run)
+	}
+
+	return snapshotId, len(removed), reinserted, nil
+}
+
+func duplicateGroups(items []userModel.PlaylistItem, groups []duplicates.Group) []duplicateGroup {
+	result := make([]duplicateGroup, len(groups))
+	for i, group := range groups {
+		result[i] = duplicateGroup{Rule: group.Rule, Tracks: make([]duplicateTrack, len(group.Positions))}
+		for j, position := range group.Positions {
+			track := &items[position].Track
+			result[i].Tracks[j] = duplicateTrack{
+				Position:   position,
+				Uri:        track.Uri,
+				Name:       track.Name,
+				Album:      track.Album.Name,
+				AddedAt:    items[position].AddedAt,
+				Popularity: track.Popularity,
+			}
+			if len(track.Artists) > 0 {
+				result[i].Tracks[j].Artist = track.Artists[0].Name
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,31 @@
+package user
+
+import (
+	resp "SpotifySorter/internal/api/response"
+	"SpotifySorter/internal/lib/client/spotify"
+	"errors"
+	"github.com/go-chi/render"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// renderSpotifyError responds with the status matching an error returned by
+// the Spotify client, passing Spotify's Retry-After on to the caller.
+func renderSpotifyError(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	render.JSON(w, r, spotifyError(w, r, err, msg))
+}
+
+// spotifyError is renderSpotifyError for handlers that add to the error
+// response: it sets the status and headers and returns the body to extend.
+func spotifyError(w http.ResponseWriter, r *http.Request, err error, msg string) resp.Response {
+	status, body := resp.SpotifyError(err, msg)
+
+	var rateLimited *spotify.ErrRateLimited
+	if errors.As(err, &rateLimited) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(rateLimited.RetryAfter.Seconds()))))
+	}
+
+	render.Status(r, status)
+	return body
+}
@@ -0,0 +1,178 @@
+package user
+
+import (
+	resp "SpotifySorter/internal/api/response"
+	jwtMiddleware "SpotifySorter/internal/http-server/middleware/jwt"
+	"SpotifySorter/internal/lib/client/spotify"
+	sl "SpotifySorter/internal/lib/logger/slog"
+	"SpotifySorter/internal/lib/sorter"
+	userModel "SpotifySorter/models"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+	"log/slog"
+	"net/http"
+)
+
+type Features interface {
+	GetAudioFeatures(trackIds []string) (map[string]userModel.AudioFeatures, map[string]bool, error)
+	SaveAudioFeatures(features []userModel.AudioFeatures) error
+	SaveUnavailableAudioFeatures(trackIds []string) error
+}
+
+func SortPlaylistByFeatures(log *slog.Logger, user User, snapshot Snapshot, features Features, api *spotify.API) http.HandlerFunc {
+	type SortKey struct {
+		Key       string `json:"key" validate:"required,oneof=name artist album release_date added_at duration popularity disc_number track_number acousticness danceability energy instrumentalness key liveness loudness mode speechiness tempo valence"`
+		Direction string `json:"direction" validate:"omitempty,oneof=asc desc"`
+	}
+	type Request struct {
+		Keys []SortKey `json:"keys" validate:"required,min=1,dive"`
+	}
+	type Response struct {
+		resp.Response
+		SnapshotId string `json:"snapshot_id"`
+		Moves      int    `json:"moves"`
+		BackupId   int64  `json:"backup_id"`
+		Missing    int    `json:"missing_features"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.features.SortPlaylistByFeatures"
+		log := log.With(slog.String("op", op))
+
+		userData := jwtMiddleware.GetUserFromContext(r.Context())
+		if userData == nil {
+			http.Error(w, "User not found", http.StatusUnauthorized)
+			return
+		}
+
+		var req Request
+		if err := render.DecodeJSON(r.Body, &req); err != nil {
+			log.Error("failed to decode request", sl.Err(err))
+			render.JSON(w, r, resp.Error("failed to decode request"))
+			return
+		}
+
+		if err := validator.New().Struct(req); err != nil {
+			log.Error("invalid request", sl.Err(err))
+			render.JSON(w, r, resp.ValidationError(err.(validator.ValidationErrors)))
+			return
+		}
+
+		specs := make([]sorter.Spec, len(req.Keys))
+		for i, key := range req.Keys {
+			specs[i] = sorter.Spec{Key: sorter.Key(key.Key), Direction: key.Direction}
+		}
+
+		id := chi.URLParam(r, "id")
+		client := api.NewClient(r.Context(), log, userData, user)
+
+		items, version, err := client.PlaylistItemsAt(id)
+		if err != nil {
+			log.Error("failed to get playlist items", sl.Err(err))
+			renderSpotifyError(w, r, err, "failed to get playlist items")
+			return
+		}
+
+		trackFeatures, err := getAudioFeatures(client, features, items)
+		if err != nil {
+			log.Error("failed to get audio features", sl.Err(err))
+			renderSpotifyError(w, r, err, "failed to get audio features")
+			return
+		}
+
+		order, err := sorter.OrderWithFeatures(items, trackFeatures, specs)
+		if err != nil {
+			log.Error("failed to sort playlist", sl.Err(err))
+			render.JSON(w, r, resp.Error("failed to sort playlist"))
+			return
+		}
+
+		backup, err := snapshotPlaylist(snapshot, userData.Id, id, version, items)
+		if err != nil {
+			log.Error("failed to snapshot playlist", sl.Err(err))
+			renderSpotifyError(w, r, err, "failed to snapshot playlist")
+			return
+		}
+
+		snapshotId, moves, err := reorderPlaylist(client, id, backup.SnapshotId, order)
+		if err != nil {
+			log.Error("failed to reorder playlist", sl.Err(err))
+			renderSpotifyError(w, r, err, "failed to reorder playlist")
+			return
+		}
+
+		missing := 0
+		for _, item := range items {
+			if _, ok := trackFeatures[item.Track.Id]; !ok {
+				missing++
+			}
+		}
+
+		render.JSON(w, r, Response{
+			Response:   resp.OK(),
+			SnapshotId: snapshotId,
+			Moves:      moves,
+			BackupId:   backup.Id,
+			Missing:    missing,
+		})
+	}
+}
+
+// getAudioFeatures returns the audio features of the playlist's tracks keyed
+// by track id. Cached features are used where possible; the rest are fetched
+// from Spotify and cached, since they never change. Tracks Spotify has no
+// features for are cached as such and left out of the result.
+func getAudioFeatures(client *spotify.Client, features Features, items []userModel.PlaylistItem) (map[string]userModel.AudioFeatures, error) {
+	seen := make(map[string]bool, len(items))
+	var ids []string
+	for _, item := range items {
+		if item.IsLocal || item.Track.Id == "" || seen[item.Track.Id] {
+			continue
+		}
+		seen[item.Track.Id] = true
+		ids = append(ids, item.Track.Id)
+	}
+
+	cached, unavailable, err := features.GetAudioFeatures(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	for _, id := range ids {
+		if _, ok := cached[id]; !ok && !unavailable[id] {
+			missing = append(missing, id)
+		}
+	}
+
+	if len(missing) == 0 {
+		return cached, nil
+	}
+
+	fetched, err := client.AudioFeatures(missing)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := features.SaveAudioFeatures(fetched); err != nil {
+		return nil, err
+	}
+
+	for _, f := range fetched {
+		cached[f.Id] = f
+	}
+
+	var none []string
+	for _, id := range missing {
+		if _, ok := cached[id]; !ok {
+			none = append(none, id)
+		}
+	}
+
+	if err := features.SaveUnavailableAudioFeatures(none); err != nil {
+		return nil, err
+	}
+
+	return cached, nil
+}
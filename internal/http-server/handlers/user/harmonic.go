@@ -0,0 +1,138 @@
+package user
+
+import (
+	resp "SpotifySorter/internal/api/response"
+	jwtMiddleware "SpotifySorter/internal/http-server/middleware/jwt"
+	"SpotifySorter/internal/lib/client/spotify"
+	"SpotifySorter/internal/lib/harmonic"
+	sl "SpotifySorter/internal/lib/logger/slog"
+	userModel "SpotifySorter/models"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"log/slog"
+	"math"
+	"net/http"
+)
+
+// HarmonicOrderPlaylist reorders a playlist for harmonic mixing: consecutive
+// tracks are compatible on the Camelot wheel and change tempo smoothly.
+// Tracks without audio features keep their relative order at the end.
+func HarmonicOrderPlaylist(log *slog.Logger, user User, snapshot Snapshot, features Features, api *spotify.API) http.HandlerFunc {
+	type Track struct {
+		Uri     string  `json:"uri"`
+		Name    string  `json:"name"`
+		Camelot string  `json:"camelot,omitempty"`
+		Tempo   float64 `json:"tempo,omitempty"`
+	}
+	type Response struct {
+		resp.Response
+		SnapshotId    string  `json:"snapshot_id"`
+		Moves         int     `json:"moves"`
+		BackupId      int64   `json:"backup_id"`
+		Score         float64 `json:"score"`
+		PreviousScore float64 `json:"previous_score"`
+		Compatible    int     `json:"compatible_transitions"`
+		Missing       int     `json:"missing_features"`
+		Tracks        []Track `json:"tracks"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.harmonic.HarmonicOrderPlaylist"
+		log := log.With(slog.String("op", op))
+
+		userData := jwtMiddleware.GetUserFromContext(r.Context())
+		if userData == nil {
+			http.Error(w, "User not found", http.StatusUnauthorized)
+			return
+		}
+
+		id := chi.URLParam(r, "id")
+		client := api.NewClient(r.Context(), log, userData, user)
+
+		items, version, err := client.PlaylistItemsAt(id)
+		if err != nil {
+			log.Error("failed to get playlist items", sl.Err(err))
+			renderSpotifyError(w, r, err, "failed to get playlist items")
+			return
+		}
+
+		trackFeatures, err := getAudioFeatures(client, features, items)
+		if err != nil {
+			log.Error("failed to get audio features", sl.Err(err))
+			renderSpotifyError(w, r, err, "failed to get audio features")
+			return
+		}
+
+		// Only tracks with features take part in the mix; positions maps them
+		// back to playlist positions.
+		var mix []userModel.AudioFeatures
+		var positions, missing []int
+		for i, item := range items {
+			if f, ok := trackFeatures[item.Track.Id]; ok {
+				mix = append(mix, f)
+				positions = append(positions, i)
+			} else {
+				missing = append(missing, i)
+			}
+		}
+
+		current := make([]int, len(mix))
+		for i := range current {
+			current[i] = i
+		}
+		path := harmonic.Order(mix)
+
+		order := make([]int, 0, len(items))
+		for _, i := range path {
+			order = append(order, positions[i])
+		}
+		order = append(order, missing...)
+
+		backup, err := snapshotPlaylist(snapshot, userData.Id, id, version, items)
+		if err != nil {
+			log.Error("failed to snapshot playlist", sl.Err(err))
+			renderSpotifyError(w, r, err, "failed to snapshot playlist")
+			return
+		}
+
+		snapshotId, moves, err := reorderPlaylist(client, id, backup.SnapshotId, order)
+		if err != nil {
+			log.Error("failed to reorder playlist", sl.Err(err))
+			renderSpotifyError(w, r, err, "failed to reorder playlist")
+			return
+		}
+
+		compatible := 0
+		for i := 1; i < len(path); i++ {
+			if harmonic.KeyDistance(&mix[path[i-1]], &mix[path[i]]) <= 1 {
+				compatible++
+			}
+		}
+
+		tracks := make([]Track, len(order))
+		for i, position := range order {
+			item := items[position]
+			tracks[i] = Track{Uri: item.Track.Uri, Name: item.Track.Name}
+			if f, ok := trackFeatures[item.Track.Id]; ok {
+				tracks[i].Camelot = harmonic.Camelot(f.Key, f.Mode)
+				tracks[i].Tempo = f.Tempo
+			}
+		}
+
+		render.JSON(w, r, Response{
+			Response:      resp.OK(),
+			SnapshotId:    snapshotId,
+			Moves:         moves,
+			BackupId:      backup.Id,
+			Score:         roundScore(harmonic.Score(mix, path)),
+			PreviousScore: roundScore(harmonic.Score(mix, current)),
+			Compatible:    compatible,
+			Missing:       len(missing),
+			Tracks:        tracks,
+		})
+	}
+}
+
+func roundScore(score float64) float64 {
+	return math.Round(score*10) / 10
+}
@@ -0,0 +1,21 @@
+package user
+
+import (
+	"SpotifySorter/internal/lib/keyset"
+	"github.com/go-chi/render"
+	"net/http"
+)
+
+type PublicKeys interface {
+	JWKS() keyset.JWKS
+}
+
+// JWKS serves the public keys that verify access tokens as a JWK Set, so
+// other services can verify tokens issued here. Keys rotate rarely, so the
+// set may be cached briefly.
+func JWKS(keys PublicKeys) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		render.JSON(w, r, keys.JWKS())
+	}
+}
@@ -0,0 +1,156 @@
+package user
+
+import (
+	resp "SpotifySorter/internal/api/response"
+	jwtMiddleware "SpotifySorter/internal/http-server/middleware/jwt"
+	"SpotifySorter/internal/lib/client/spotify"
+	sl "SpotifySorter/internal/lib/logger/slog"
+	"SpotifySorter/internal/lib/merge"
+	"SpotifySorter/internal/lib/sorter"
+	userModel "SpotifySorter/models"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+	"log/slog"
+	"net/http"
+)
+
+// MergePlaylists combines several playlists into a new playlist or appends
+// them to an existing one, which is snapshotted first. Local files cannot be
+// added through the Web API and, like duplicates, are reported as skipped.
+func MergePlaylists(log *slog.Logger, user User, snapshot Snapshot, api *spotify.API) http.HandlerFunc {
+	type Target struct {
+		Id     string `json:"id" validate:"required_without=Name"`
+		Name   string `json:"name" validate:"required_without=Id,max=100"`
+		Public *bool  `json:"public"`
+	}
+	type Request struct {
+		PlaylistIds []string  `json:"playlist_ids" validate:"required,min=1,max=50,dive,required"`
+		Target      Target    `json:"target"`
+		Mode        string    `json:"mode" validate:"required,oneof=concatenate round_robin sorted"`
+		Keys        []sortKey `json:"keys" validate:"required_if=Mode sorted,omitempty,dive"`
+		Dedupe      bool      `json:"dedupe"`
+	}
+	type Response struct {
+		resp.Response
+		PlaylistId string `json:"playlist_id"`
+		SnapshotId string `json:"snapshot_id"`
+		Added      int    `json:"added"`
+		Skipped    int    `json:"skipped"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.merge.MergePlaylists"
+		log := log.With(slog.String("op", op))
+
+		userData := jwtMiddleware.GetUserFromContext(r.Context())
+		if userData == nil {
+			http.Error(w, "User not found", http.StatusUnauthorized)
+			return
+		}
+
+		var req Request
+		if err := render.DecodeJSON(r.Body, &req); err != nil {
+			log.Error("failed to decode request", sl.Err(err))
+			render.JSON(w, r, resp.Error("failed to decode request"))
+			return
+		}
+
+		if err := validator.New().Struct(req); err != nil {
+			log.Error("invalid request", sl.Err(err))
+			render.JSON(w, r, resp.ValidationError(err.(validator.ValidationErrors)))
+			return
+		}
+
+		specs := make([]sorter.Spec, len(req.Keys))
+		for i, key := range req.Keys {
+			specs[i] = sorter.Spec{Key: sorter.Key(key.Key), Direction: key.Direction}
+		}
+
+		client := api.NewClient(r.Context(), log, userData, user)
+
+		sources := make([][]userModel.PlaylistItem, len(req.PlaylistIds))
+		for i, id := range req.PlaylistIds {
+			items, err := client.PlaylistItems(id)
+			if err != nil {
+				log.Error("failed to get playlist items", slog.String("playlist", id), sl.Err(err))
+				renderSpotifyError(w, r, err, "failed to get playlist items")
+				return
+			}
+			sources[i] = items
+		}
+
+		merged, err := merge.Merge(sources, merge.Mode(req.Mode), specs)
+		if err != nil {
+			log.Error("failed to merge playlists", sl.Err(err))
+			render.JSON(w, r, resp.Error("failed to merge playlists"))
+			return
+		}
+
+		var existing []userModel.PlaylistItem
+		if req.Target.Id != "" {
+			var version string
+			existing, version, err = client.PlaylistItemsAt(req.Target.Id)
+			if err != nil {
+				log.Error("failed to get target playlist items", sl.Err(err))
+				renderSpotifyError(w, r, err, "failed to get target playlist items")
+				return
+			}
+
+			if _, err := snapshotPlaylist(snapshot, userData.Id, req.Target.Id, version, existing); err != nil {
+				log.Error("failed to snapshot playlist", sl.Err(err))
+				renderSpotifyError(w, r, err, "failed to snapshot playlist")
+				return
+			}
+		}
+
+		skipped := 0
+		if req.Dedupe {
+			merged, skipped, err = merge.Dedupe(merged, existing)
+			if err != nil {
+				log.Error("failed to dedupe playlists", sl.Err(err))
+				render.JSON(w, r, resp.Error("failed to dedupe playlists"))
+				return
+			}
+		}
+
+		uris := make([]string, 0, len(merged))
+		for _, item := range merged {
+			if item.Track.Uri == "" || item.IsLocal {
+				skipped++
+				continue
+			}
+			uris = append(uris, item.Track.Uri)
+		}
+
+		targetId, snapshotId := req.Target.Id, ""
+		if targetId == "" {
+			playlist, err := client.CreatePlaylist(userData.IdSpotify, userModel.PlaylistDetails{
+				Name:   req.Target.Name,
+				Public: req.Target.Public,
+			})
+			if err != nil {
+				log.Error("failed to create playlist", sl.Err(err))
+				renderSpotifyError(w, r, err, "failed to create playlist")
+				return
+			}
+			targetId, snapshotId = playlist.Id, playlist.SnapshotId
+		}
+
+		if len(uris) > 0 {
+			snapshotId, err = client.AddItems(targetId, uris, -1)
+			if err != nil {
+				log.Error("failed to add items", slog.String("playlist", targetId), sl.Err(err))
+				renderSpotifyError(w, r, err, "failed to add items")
+				return
+			}
+		}
+
+		render.JSON(w, r, Response{
+			Response:   resp.OK(),
+			PlaylistId: targetId,
+			SnapshotId: snapshotId,
+			Added:      len(uris),
+			Skipped:    skipped,
+		})
+	}
+}
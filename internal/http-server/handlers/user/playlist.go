@@ -4,8 +4,9 @@ import (
 	resp "SpotifySorter/internal/api/response"
 	jwtMiddleware "SpotifySorter/internal/http-server/middleware/jwt"
 	"SpotifySorter/internal/lib/client/spotify"
+	"SpotifySorter/internal/lib/filter"
 	sl "SpotifySorter/internal/lib/logger/slog"
-	"encoding/json"
+	userModel "SpotifySorter/models"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
 
@@ -13,55 +14,10 @@ import (
 	"net/http"
 )
 
-func GetAllPlaylists(log *slog.Logger, user User) http.HandlerFunc {
-	type Response struct {
-		Href     string `json:"href"`
-		Limit    int    `json:"limit"`
-		Next     string `json:"next"`
-		Offset   int    `json:"offset"`
-		Previous string `json:"previous"`
-		Total    int    `json:"total"`
-		Items    []struct {
-			Collaborative bool   `json:"collaborative"`
-			Description   string `json:"description"`
-			ExternalUrls  struct {
-				Spotify string `json:"spotify"`
-			} `json:"external_urls"`
-			Href   string `json:"href"`
-			Id     string `json:"id"`
-			Images []struct {
-				Url    string `json:"url"`
-				Height int    `json:"height"`
-				Width  int    `json:"width"`
-			} `json:"images"`
-			Name  string `json:"name"`
-			Owner struct {
-				ExternalUrls struct {
-					Spotify string `json:"spotify"`
-				} `json:"external_urls"`
-				Followers struct {
-					Href  string `json:"href"`
-					Total int    `json:"total"`
-				} `json:"followers"`
-				Href        string `json:"href"`
-				Id          string `json:"id"`
-				Type        string `json:"type"`
-				Uri         string `json:"uri"`
-				DisplayName string `json:"display_name"`
-			} `json:"owner"`
-			Public     bool   `json:"public"`
-			SnapshotId string `json:"snapshot_id"`
-			Tracks     struct {
-				Href  string `json:"href"`
-				Total int    `json:"total"`
-			} `json:"tracks"`
-			Type string `json:"type"`
-			Uri  string `json:"uri"`
-		} `json:"items"`
-	}
+func GetAllPlaylists(log *slog.Logger, user User, api *spotify.API) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "handlers.playlist.GetAllPlaylists"
-		log = log.With(slog.String("op", op))
+		log := log.With(slog.String("op", op))
 
 		userData := jwtMiddleware.GetUserFromContext(r.Context())
 		if userData == nil {
@@ -69,128 +25,26 @@ func GetAllPlaylists(log *slog.Logger, user User) http.HandlerFunc {
 			return
 		}
 
-		response, err := spotify.GetRequest(log, userData.SpotifyAccessToken, "users/"+userData.IdSpotify+"/playlists")
+		playlists, err := api.NewClient(r.Context(), log, userData, user).UserPlaylists(userData.IdSpotify)
 
 		if err != nil {
 			log.Error("failed to get all playlists from Spotify", sl.Err(err))
-			render.JSON(w, r, resp.Error("failed to get all playlists from Spotify"))
-			return
-		}
-
-		var playlists Response
-		if err := json.Unmarshal(response, &playlists); err != nil {
-			log.Error("failed to decode response", sl.Err(err))
-			render.JSON(w, r, resp.Error("failed to decode response"))
+			renderSpotifyError(w, r, err, "failed to get all playlists from Spotify")
 			return
 		}
 
-		render.JSON(w, r, playlists)
+		render.JSON(w, r, completePage(playlists))
 	}
 }
 
-func GetPlaylistById(log *slog.Logger, user User) http.HandlerFunc {
-	type Response struct {
-		Href     string `json:"href"`
-		Limit    int    `json:"limit"`
-		Next     string `json:"next"`
-		Offset   int    `json:"offset"`
-		Previous string `json:"previous"`
-		Total    int    `json:"total"`
-		Items    []struct {
-			AddedAt string `json:"added_at"`
-			AddedBy struct {
-				ExternalUrls struct {
-					Spotify string `json:"spotify"`
-				} `json:"external_urls"`
-				Followers struct {
-					Href  string `json:"href"`
-					Total int    `json:"total"`
-				} `json:"followers"`
-				Href string `json:"href"`
-				Id   string `json:"id"`
-				Type string `json:"type"`
-				Uri  string `json:"uri"`
-			} `json:"added_by"`
-			IsLocal bool `json:"is_local"`
-			Track   struct {
-				Album struct {
-					AlbumType        string   `json:"album_type"`
-					TotalTracks      int      `json:"total_tracks"`
-					AvailableMarkets []string `json:"available_markets"`
-					ExternalUrls     struct {
-						Spotify string `json:"spotify"`
-					} `json:"external_urls"`
-					Href   string `json:"href"`
-					Id     string `json:"id"`
-					Images []struct {
-						Url    string `json:"url"`
-						Height int    `json:"height"`
-						Width  int    `json:"width"`
-					} `json:"images"`
-					Name                 string `json:"name"`
-					ReleaseDate          string `json:"release_date"`
-					ReleaseDatePrecision string `json:"release_date_precision"`
-					Restrictions         struct {
-						Reason string `json:"reason"`
-					} `json:"restrictions"`
-					Type    string `json:"type"`
-					Uri     string `json:"uri"`
-					Artists []struct {
-						ExternalUrls struct {
-							Spotify string `json:"spotify"`
-						} `json:"external_urls"`
-						Href string `json:"href"`
-						Id   string `json:"id"`
-						Name string `json:"name"`
-						Type string `json:"type"`
-						Uri  string `json:"uri"`
-					} `json:"artists"`
-				} `json:"album"`
-				Artists []struct {
-					ExternalUrls struct {
-						Spotify string `json:"spotify"`
-					} `json:"external_urls"`
-					Href string `json:"href"`
-					Id   string `json:"id"`
-					Name string `json:"name"`
-					Type string `json:"type"`
-					Uri  string `json:"uri"`
-				} `json:"artists"`
-				AvailableMarkets []string `json:"available_markets"`
-				DiscNumber       int      `json:"disc_number"`
-				DurationMs       int      `json:"duration_ms"`
-				Explicit         bool     `json:"explicit"`
-				ExternalIds      struct {
-					Isrc string `json:"isrc"`
-					Ean  string `json:"ean"`
-					Upc  string `json:"upc"`
-				} `json:"external_ids"`
-				ExternalUrls struct {
-					Spotify string `json:"spotify"`
-				} `json:"external_urls"`
-				Href       string `json:"href"`
-				Id         string `json:"id"`
-				IsPlayable bool   `json:"is_playable"`
-				LinkedFrom struct {
-				} `json:"linked_from"`
-				Restrictions struct {
-					Reason string `json:"reason"`
-				} `json:"restrictions"`
-				Name        string `json:"name"`
-				Popularity  int    `json:"popularity"`
-				PreviewUrl  string `json:"preview_url"`
-				TrackNumber int    `json:"track_number"`
-				Type        string `json:"type"`
-				Uri         string `json:"uri"`
-				IsLocal     bool   `json:"is_local"`
-			} `json:"track"`
-		} `json:"items"`
-	}
-
+// GetPlaylistById returns the items of a playlist. The optional filter query
+// parameter selects items with a filter expression, e.g.
+// ?filter=year >= 1990 and not explicit.
+func GetPlaylistById(log *slog.Logger, user User, api *spotify.API) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "handlers.playlist.GetPlaylistById"
 
-		log = log.With(slog.String("op", op))
+		log := log.With(slog.String("op", op))
 
 		userData := jwtMiddleware.GetUserFromContext(r.Context())
 		if userData == nil {
@@ -198,22 +52,45 @@ func GetPlaylistById(log *slog.Logger, user User) http.HandlerFunc {
 			return
 		}
 
+		var itemFilter *filter.Filter
+		if expr := r.URL.Query().Get("filter"); expr != "" {
+			var err error
+			itemFilter, err = filter.Compile(expr)
+			if err != nil {
+				log.Error("invalid filter", sl.Err(err))
+				render.Status(r, http.StatusBadRequest)
+				render.JSON(w, r, resp.Error(err.Error()))
+				return
+			}
+		}
+
 		id := chi.URLParam(r, "id")
 
-		response, err := spotify.GetRequest(log, userData.SpotifyAccessToken, "playlists/"+id+"/tracks/")
+		items, err := api.NewClient(r.Context(), log, userData, user).PlaylistItems(id)
 		if err != nil {
 			log.Error("Error getting playlist by ID", sl.Err(err))
-			http.Error(w, "Error getting playlist by ID", http.StatusInternalServerError)
+			renderSpotifyError(w, r, err, "Error getting playlist by ID")
 			return
 		}
 
-		var playlist Response
-		if err := json.Unmarshal(response, &playlist); err != nil {
-			log.Error("failed to decode response", sl.Err(err))
-			render.JSON(w, r, resp.Error("failed to decode response"))
-			return
+		if itemFilter != nil {
+			items = itemFilter.Apply(items)
 		}
 
-		render.JSON(w, r, playlist)
+		render.JSON(w, r, completePage(items))
+	}
+}
+
+// completePage wraps a fully fetched collection into a single page, so the
+// response keeps the shape of the Web API's paged responses.
+func completePage[T any](items []T) userModel.Page[T] {
+	if items == nil {
+		items = []T{}
+	}
+
+	return userModel.Page[T]{
+		Limit: len(items),
+		Total: len(items),
+		Items: items,
 	}
 }
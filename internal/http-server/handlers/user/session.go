@@ -0,0 +1,142 @@
+package user
+
+import (
+	resp "SpotifySorter/internal/api/response"
+	jwtMiddleware "SpotifySorter/internal/http-server/middleware/jwt"
+	sl "SpotifySorter/internal/lib/logger/slog"
+	"SpotifySorter/internal/storage"
+	userModel "SpotifySorter/models"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// maxDeviceLength is the size of the sessions.device column.
+const maxDeviceLength = 512
+
+type Sessions interface {
+	SaveSession(id string, userId int64, device, ip string) (*userModel.Session, error)
+	GetSession(id string) (*userModel.Session, error)
+	GetSessions(userId int64) ([]userModel.Session, error)
+	TouchSession(id, ip string) error
+	RevokeSession(userId int64, id string) error
+	DeleteExpiredSessions(userId int64) error
+}
+
+// Logout revokes the session of the access token, so neither its access
+// tokens nor its refresh token work any longer.
+func Logout(log *slog.Logger, sessions Sessions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.user.Logout"
+		log := log.With(slog.String("op", op))
+
+		userData := jwtMiddleware.GetUserFromContext(r.Context())
+		if userData == nil {
+			http.Error(w, "User not found", http.StatusUnauthorized)
+			return
+		}
+
+		sessionId := jwtMiddleware.GetSessionFromContext(r.Context())
+
+		err := sessions.RevokeSession(userData.Id, sessionId)
+		if err != nil && !errors.Is(err, storage.ErrSessionNotFound) {
+			log.Error("failed to revoke session", sl.Err(err))
+			render.JSON(w, r, resp.Error("failed to log out"))
+			return
+		}
+
+		render.JSON(w, r, resp.OK())
+	}
+}
+
+// GetSessions lists the user's active sessions. The session of the request
+// is marked as current.
+func GetSessions(log *slog.Logger, sessions Sessions) http.HandlerFunc {
+	type Response struct {
+		resp.Response
+		Sessions []userModel.Session `json:"sessions"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.user.GetSessions"
+		log := log.With(slog.String("op", op))
+
+		userData := jwtMiddleware.GetUserFromContext(r.Context())
+		if userData == nil {
+			http.Error(w, "User not found", http.StatusUnauthorized)
+			return
+		}
+
+		list, err := sessions.GetSessions(userData.Id)
+		if err != nil {
+			log.Error("failed to get sessions", sl.Err(err))
+			render.JSON(w, r, resp.Error("failed to get sessions"))
+			return
+		}
+
+		current := jwtMiddleware.GetSessionFromContext(r.Context())
+		for i := range list {
+			list[i].Current = list[i].Id == current
+		}
+
+		render.JSON(w, r, Response{
+			Response: resp.OK(),
+			Sessions: list,
+		})
+	}
+}
+
+// DeleteSession revokes one of the user's sessions, signing out its device.
+func DeleteSession(log *slog.Logger, sessions Sessions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.user.DeleteSession"
+		log := log.With(slog.String("op", op))
+
+		userData := jwtMiddleware.GetUserFromContext(r.Context())
+		if userData == nil {
+			http.Error(w, "User not found", http.StatusUnauthorized)
+			return
+		}
+
+		err := sessions.RevokeSession(userData.Id, chi.URLParam(r, "id"))
+		if err != nil {
+			if errors.Is(err, storage.ErrSessionNotFound) {
+				render.Status(r, http.StatusNotFound)
+				render.JSON(w, r, resp.NotFound("session not found"))
+				return
+			}
+			log.Error("failed to revoke session", sl.Err(err))
+			render.JSON(w, r, resp.Error("failed to revoke session"))
+			return
+		}
+
+		render.JSON(w, r, resp.OK())
+	}
+}
+
+// startSession starts a session for the device of the request and issues
+// its first tokens.
+func startSession(sessions Sessions, refreshTokens RefreshTokens, r *http.Request, userId int64, issuer TokenIssuer) (*userModel.Tokens, error) {
+	if err := sessions.DeleteExpiredSessions(userId); err != nil {
+		return nil, err
+	}
+
+	id, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	device := r.UserAgent()
+	if len(device) > maxDeviceLength {
+		device = strings.ToValidUTF8(device[:maxDeviceLength], "")
+	}
+
+	if _, err := sessions.SaveSession(id, userId, device, jwtMiddleware.ClientIp(r)); err != nil {
+		return nil, err
+	}
+
+	return issueTokens(refreshTokens, userId, id, issuer)
+}
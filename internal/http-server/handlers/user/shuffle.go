@@ -0,0 +1,113 @@
+package user
+
+import (
+	resp "SpotifySorter/internal/api/response"
+	jwtMiddleware "SpotifySorter/internal/http-server/middleware/jwt"
+	"SpotifySorter/internal/lib/client/spotify"
+	sl "SpotifySorter/internal/lib/logger/slog"
+	"SpotifySorter/internal/lib/shuffle"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultArtistGap = 3
+	defaultAlbumGap  = 5
+)
+
+// ShufflePlaylist permanently reorders a playlist with a spread shuffle, which
+// keeps tracks by the same artist or from the same album apart. The seed used
+// is returned so the order can be reproduced.
+func ShufflePlaylist(log *slog.Logger, user User, snapshot Snapshot, api *spotify.API) http.HandlerFunc {
+	type Request struct {
+		ArtistGap *int   `json:"artist_gap" validate:"omitempty,min=0,max=100"`
+		AlbumGap  *int   `json:"album_gap" validate:"omitempty,min=0,max=100"`
+		Seed      *int64 `json:"seed"`
+	}
+	type Response struct {
+		resp.Response
+		SnapshotId string `json:"snapshot_id"`
+		Moves      int    `json:"moves"`
+		BackupId   int64  `json:"backup_id"`
+		Seed       int64  `json:"seed"`
+		Violations int    `json:"violations"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.shuffle.ShufflePlaylist"
+		log := log.With(slog.String("op", op))
+
+		userData := jwtMiddleware.GetUserFromContext(r.Context())
+		if userData == nil {
+			http.Error(w, "User not found", http.StatusUnauthorized)
+			return
+		}
+
+		var req Request
+		if err := render.DecodeJSON(r.Body, &req); err != nil {
+			log.Error("failed to decode request", sl.Err(err))
+			render.JSON(w, r, resp.Error("failed to decode request"))
+			return
+		}
+
+		if err := validator.New().Struct(req); err != nil {
+			log.Error("invalid request", sl.Err(err))
+			render.JSON(w, r, resp.ValidationError(err.(validator.ValidationErrors)))
+			return
+		}
+
+		opts := shuffle.Options{
+			ArtistGap: defaultArtistGap,
+			AlbumGap:  defaultAlbumGap,
+			Seed:      time.Now().UnixNano(),
+		}
+		if req.ArtistGap != nil {
+			opts.ArtistGap = *req.ArtistGap
+		}
+		if req.AlbumGap != nil {
+			opts.AlbumGap = *req.AlbumGap
+		}
+		if req.Seed != nil {
+			opts.Seed = *req.Seed
+		}
+
+		id := chi.URLParam(r, "id")
+		client := api.NewClient(r.Context(), log, userData, user)
+
+		items, version, err := client.PlaylistItemsAt(id)
+		if err != nil {
+			log.Error("failed to get playlist items", sl.Err(err))
+			renderSpotifyError(w, r, err, "failed to get playlist items")
+			return
+		}
+
+		order, violations := shuffle.Spread(items, opts)
+
+		backup, err := snapshotPlaylist(snapshot, userData.Id, id, version, items)
+		if err != nil {
+			log.Error("failed to snapshot playlist", sl.Err(err))
+			renderSpotifyError(w, r, err, "failed to snapshot playlist")
+			return
+		}
+
+		snapshotId, moves, err := reorderPlaylist(client, id, backup.SnapshotId, order)
+		if err != nil {
+			log.Error("failed to reorder playlist", sl.Err(err))
+			renderSpotifyError(w, r, err, "failed to reorder playlist")
+			return
+		}
+
+		render.JSON(w, r, Response{
+			Response:   resp.OK(),
+			SnapshotId: snapshotId,
+			Moves:      moves,
+			BackupId:   backup.Id,
+			Seed:       opts.Seed,
+			Violations: violations,
+		})
+	}
+}
@@ -0,0 +1,452 @@
+package user
+
+import (
+	resp "SpotifySorter/internal/api/response"
+	jwtMiddleware "SpotifySorter/internal/http-server/middleware/jwt"
+	"SpotifySorter/internal/lib/client/spotify"
+	sl "SpotifySorter/internal/lib/logger/slog"
+	"SpotifySorter/internal/lib/merge"
+	smartRules "SpotifySorter/internal/lib/smart"
+	"SpotifySorter/internal/storage"
+	userModel "SpotifySorter/models"
+	"context"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type Smart interface {
+	SaveSmartPlaylist(userId int64, name string, rules userModel.SmartRules) (*userModel.SmartPlaylist, error)
+	GetSmartPlaylists(userId int64) ([]userModel.SmartPlaylist, error)
+	GetSmartPlaylist(userId, id int64) (*userModel.SmartPlaylist, error)
+	GetSmartPlaylistsSyncedBefore(before time.Time) ([]userModel.SmartPlaylist, error)
+	UpdateSmartPlaylist(userId, id int64, name string, rules userModel.SmartRules) error
+	DeleteSmartPlaylist(userId, id int64) error
+	SetSmartPlaylistSynced(id int64, playlistId string, syncedAt time.Time) error
+}
+
+// SmartUsers loads the owners of smart playlists synced in the background.
+type SmartUsers interface {
+	GetUserById(id int64) (*userModel.User, error)
+	UpdateSpotifyTokens(userId int64, accessToken, refreshToken string, expiresAt time.Time) error
+}
+
+type smartRequest struct {
+	Name  string               `json:"name" validate:"required,max=100"`
+	Rules userModel.SmartRules `json:"rules"`
+}
+
+func CreateSmartPlaylist(log *slog.Logger, smart Smart) http.HandlerFunc {
+	type Response struct {
+		resp.Response
+		Smart *userModel.SmartPlaylist `json:"smart_playlist"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.smart.CreateSmartPlaylist"
+		log := log.With(slog.String("op", op))
+
+		userData := jwtMiddleware.GetUserFromContext(r.Context())
+		if userData == nil {
+			http.Error(w, "User not found", http.StatusUnauthorized)
+			return
+		}
+
+		req, ok := decodeSmartRequest(w, r, log)
+		if !ok {
+			return
+		}
+
+		saved, err := smart.SaveSmartPlaylist(userData.Id, req.Name, req.Rules)
+		if err != nil {
+			log.Error("failed to save smart playlist", sl.Err(err))
+			render.JSON(w, r, resp.Error("failed to save smart playlist"))
+			return
+		}
+
+		render.JSON(w, r, Response{
+			Response: resp.OK(),
+			Smart:    saved,
+		})
+	}
+}
+
+func GetSmartPlaylists(log *slog.Logger, smart Smart) http.HandlerFunc {
+	type Response struct {
+		resp.Response
+		Smart []userModel.SmartPlaylist `json:"smart_playlists"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.smart.GetSmartPlaylists"
+		log := log.With(slog.String("op", op))
+
+		userData := jwtMiddleware.GetUserFromContext(r.Context())
+		if userData == nil {
+			http.Error(w, "User not found", http.StatusUnauthorized)
+			return
+		}
+
+		smarts, err := smart.GetSmartPlaylists(userData.Id)
+		if err != nil {
+			log.Error("failed to get smart playlists", sl.Err(err))
+			render.JSON(w, r, resp.Error("failed to get smart playlists"))
+			return
+		}
+
+		render.JSON(w, r, Response{
+			Response: resp.OK(),
+			Smart:    smarts,
+		})
+	}
+}
+
+func GetSmartPlaylist(log *slog.Logger, smart Smart) http.HandlerFunc {
+	type Response struct {
+		resp.Response
+		Smart *userModel.SmartPlaylist `json:"smart_playlist"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.smart.GetSmartPlaylist"
+		log := log.With(slog.String("op", op))
+
+		userData := jwtMiddleware.GetUserFromContext(r.Context())
+		if userData == nil {
+			http.Error(w, "User not found", http.StatusUnauthorized)
+			return
+		}
+
+		saved, ok := loadSmartPlaylist(w, r, log, smart, userData.Id)
+		if !ok {
+			return
+		}
+
+		render.JSON(w, r, Response{
+			Response: resp.OK(),
+			Smart:    saved,
+		})
+	}
+}
+
+// UpdateSmartPlaylist replaces the name and rules of a smart playlist. The
+// Spotify playlist changes on the next sync.
+func UpdateSmartPlaylist(log *slog.Logger, smart Smart) http.HandlerFunc {
+	type Response struct {
+		resp.Response
+		Smart *userModel.SmartPlaylist `json:"smart_playlist"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.smart.UpdateSmartPlaylist"
+		log := log.With(slog.String("op", op))
+
+		userData := jwtMiddleware.GetUserFromContext(r.Context())
+		if userData == nil {
+			http.Error(w, "User not found", http.StatusUnauthorized)
+			return
+		}
+
+		saved, ok := loadSmartPlaylist(w, r, log, smart, userData.Id)
+		if !ok {
+			return
+		}
+
+		req, ok := decodeSmartRequest(w, r, log)
+		if !ok {
+			return
+		}
+
+		if err := smart.UpdateSmartPlaylist(userData.Id, saved.Id, req.Name, req.Rules); err != nil {
+			log.Error("failed to update smart playlist", sl.Err(err))
+			render.JSON(w, r, resp.Error("failed to update smart playlist"))
+			return
+		}
+
+		saved.Name, saved.Rules = req.Name, req.Rules
+
+		render.JSON(w, r, Response{
+			Response: resp.OK(),
+			Smart:    saved,
+		})
+	}
+}
+
+// DeleteSmartPlaylist deletes the rules of a smart playlist. The Spotify
+// playlist it was materialized into is kept.
+func DeleteSmartPlaylist(log *slog.Logger, smart Smart) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.smart.DeleteSmartPlaylist"
+		log := log.With(slog.String("op", op))
+
+		userData := jwtMiddleware.GetUserFromContext(r.Context())
+		if userData == nil {
+			http.Error(w, "User not found", http.StatusUnauthorized)
+			return
+		}
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			log.Error("invalid smart playlist id", sl.Err(err))
+			render.JSON(w, r, resp.Error("invalid smart playlist id"))
+			return
+		}
+
+		if err := smart.DeleteSmartPlaylist(userData.Id, id); err != nil {
+			if errors.Is(err, storage.ErrSmartNotFound) {
+				render.Status(r, http.StatusNotFound)
+				render.JSON(w, r, resp.NotFound("smart playlist not found"))
+				return
+			}
+			log.Error("failed to delete smart playlist", sl.Err(err))
+			render.JSON(w, r, resp.Error("failed to delete smart playlist"))
+			return
+		}
+
+		render.JSON(w, r, resp.OK())
+	}
+}
+
+// SyncSmartPlaylist materializes a smart playlist into its Spotify playlist
+// now, creating the playlist on the first sync.
+func SyncSmartPlaylist(log *slog.Logger, user User, smart Smart, snapshot Snapshot, features Features, api *spotify.API) http.HandlerFunc {
+	type Response struct {
+		resp.Response
+		Smart  *userModel.SmartPlaylist `json:"smart_playlist"`
+		Tracks int                      `json:"tracks"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.smart.SyncSmartPlaylist"
+		log := log.With(slog.String("op", op))
+
+		userData := jwtMiddleware.GetUserFromContext(r.Context())
+		if userData == nil {
+			http.Error(w, "User not found", http.StatusUnauthorized)
+			return
+		}
+
+		saved, ok := loadSmartPlaylist(w, r, log, smart, userData.Id)
+		if !ok {
+			return
+		}
+
+		client := api.NewClient(r.Context(), log, userData, user)
+
+		tracks, err := syncSmartPlaylist(client, smart, snapshot, features, userData.IdSpotify, saved)
+		if err != nil {
+			log.Error("failed to sync smart playlist", sl.Err(err))
+			renderSpotifyError(w, r, err, "failed to sync smart playlist")
+			return
+		}
+
+		render.JSON(w, r, Response{
+			Response: resp.OK(),
+			Smart:    saved,
+			Tracks:   tracks,
+		})
+	}
+}
+
+// SyncSmartPlaylists keeps smart playlists up to date in the background:
+// every interval it syncs those last synced more than interval ago. It
+// returns when ctx is done.
+func SyncSmartPlaylists(ctx context.Context, log *slog.Logger, users SmartUsers, smart Smart, snapshot Snapshot, features Features, api *spotify.API, interval time.Duration) {
+	const op = "handlers.smart.SyncSmartPlaylists"
+	log = log.With(slog.String("op", op))
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		due, err := smart.GetSmartPlaylistsSyncedBefore(time.Now().Add(-interval))
+		if err != nil {
+			log.Error("failed to get smart playlists", sl.Err(err))
+		}
+
+		owners := make(map[int64]*userModel.User)
+		for i := range due {
+			if ctx.Err() != nil {
+				return
+			}
+
+			saved := &due[i]
+			log := log.With(slog.Int64("smart_playlist", saved.Id))
+
+			owner, ok := owners[saved.UserId]
+			if !ok {
+				owner, err = users.GetUserById(saved.UserId)
+				if err != nil {
+					log.Error("failed to get user", sl.Err(err))
+					continue
+				}
+				owners[saved.UserId] = owner
+			}
+
+			client := api.NewClient(ctx, log, owner, users)
+
+			tracks, err := syncSmartPlaylist(client, smart, snapshot, features, owner.IdSpotify, saved)
+			if err != nil {
+				log.Error("failed to sync smart playlist", sl.Err(err))
+				continue
+			}
+			log.Info("smart playlist synced", slog.Int("tracks", tracks))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// syncSmartPlaylist collects the tracks of the smart playlist's sources,
+// applies its rules and replaces the contents of its Spotify playlist with
+// the result, after snapshotting its previous contents. A playlist that was
+// deleted on Spotify is created again. It returns the number of tracks
+// written.
+func syncSmartPlaylist(client *spotify.Client, smart Smart, snapshot Snapshot, features Features, spotifyUserId string, saved *userModel.SmartPlaylist) (int, error) {
+	rules := &saved.Rules
+
+	var items []userModel.PlaylistItem
+	if rules.Sources.LikedSongs {
+		liked, err := client.SavedTracks()
+		if err != nil {
+			return 0, err
+		}
+		items = append(items, liked...)
+	}
+
+	for _, id := range rules.Sources.PlaylistIds {
+		// A smart playlist never reads its own previous contents.
+		if id == saved.PlaylistId {
+			continue
+		}
+
+		playlistItems, err := client.PlaylistItems(id)
+		if err != nil {
+			return 0, err
+		}
+		items = append(items, playlistItems...)
+	}
+
+	items, _, err := merge.Dedupe(items, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	var trackFeatures map[string]userModel.AudioFeatures
+	if smartRules.NeedsFeatures(rules) {
+		trackFeatures, err = getAudioFeatures(client, features, items)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	selected, err := smartRules.Apply(items, trackFeatures, rules)
+	if err != nil {
+		return 0, err
+	}
+
+	uris := make([]string, 0, len(selected))
+	for _, item := range selected {
+		if item.Track.Uri != "" && !item.IsLocal {
+			uris = append(uris, item.Track.Uri)
+		}
+	}
+
+	playlistId := saved.PlaylistId
+	if playlistId != "" {
+		current, version, err := client.PlaylistItemsAt(playlistId)
+		switch {
+		case errors.Is(err, spotify.ErrNotFound):
+			playlistId = ""
+		case err != nil:
+			return 0, err
+		default:
+			if _, err := snapshotPlaylist(snapshot, saved.UserId, playlistId, version, current); err != nil {
+				return 0, err
+			}
+			if _, err := client.ReplaceItems(playlistId, uris); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if playlistId == "" {
+		playlist, err := client.CreatePlaylist(spotifyUserId, userModel.PlaylistDetails{
+			Name:        saved.Name,
+			Description: "Smart playlist, kept in sync automatically",
+		})
+		if err != nil {
+			return 0, err
+		}
+		playlistId = playlist.Id
+
+		if len(uris) > 0 {
+			if _, err := client.AddItems(playlistId, uris, -1); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	now := time.Now()
+	if err := smart.SetSmartPlaylistSynced(saved.Id, playlistId, now); err != nil {
+		return 0, err
+	}
+	saved.PlaylistId, saved.SyncedAt = playlistId, &now
+
+	return len(uris), nil
+}
+
+func decodeSmartRequest(w http.ResponseWriter, r *http.Request, log *slog.Logger) (*smartRequest, bool) {
+	var req smartRequest
+	if err := render.DecodeJSON(r.Body, &req); err != nil {
+		log.Error("failed to decode request", sl.Err(err))
+		render.JSON(w, r, resp.Error("failed to decode request"))
+		return nil, false
+	}
+
+	if err := validator.New().Struct(req); err != nil {
+		log.Error("invalid request", sl.Err(err))
+		render.JSON(w, r, resp.ValidationError(err.(validator.ValidationErrors)))
+		return nil, false
+	}
+
+	if err := smartRules.Validate(&req.Rules); err != nil {
+		log.Error("invalid rules", sl.Err(err))
+		render.JSON(w, r, resp.Error(err.Error()))
+		return nil, false
+	}
+
+	return &req, true
+}
+
+func loadSmartPlaylist(w http.ResponseWriter, r *http.Request, log *slog.Logger, smart Smart, userId int64) (*userModel.SmartPlaylist, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		log.Error("invalid smart playlist id", sl.Err(err))
+		render.JSON(w, r, resp.Error("invalid smart playlist id"))
+		return nil, false
+	}
+
+	saved, err := smart.GetSmartPlaylist(userId, id)
+	if err != nil {
+		if errors.Is(err, storage.ErrSmartNotFound) {
+			render.Status(r, http.StatusNotFound)
+			render.JSON(w, r, resp.NotFound("smart playlist not found"))
+			return nil, false
+		}
+		log.Error("failed to get smart playlist", sl.Err(err))
+		render.JSON(w, r, resp.Error("failed to get smart playlist"))
+		return nil, false
+	}
+
+	return saved, true
+}
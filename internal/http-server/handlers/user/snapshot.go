@@ -0,0 +1,246 @@
+package user
+
+import (
+	resp "SpotifySorter/internal/api/response"
+	jwtMiddleware "SpotifySorter/internal/http-server/middleware/jwt"
+	"SpotifySorter/internal/lib/client/spotify"
+	sl "SpotifySorter/internal/lib/logger/slog"
+	"SpotifySorter/internal/storage"
+	userModel "SpotifySorter/models"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type Snapshot interface {
+	SavePlaylistSnapshot(userId int64, playlistId, snapshotId string, trackUris []string) (*userModel.PlaylistSnapshot, error)
+	GetPlaylistSnapshots(userId int64, playlistId string) ([]userModel.PlaylistSnapshot, error)
+	GetPlaylistSnapshot(userId, id int64) (*userModel.PlaylistSnapshot, error)
+}
+
+func GetPlaylistSnapshots(log *slog.Logger, snapshot Snapshot) http.HandlerFunc {
+	type Response struct {
+		resp.Response
+		Snapshots []userModel.PlaylistSnapshot `json:"snapshots"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.snapshot.GetPlaylistSnapshots"
+		log := log.With(slog.String("op", op))
+
+		userData := jwtMiddleware.GetUserFromContext(r.Context())
+		if userData == nil {
+			http.Error(w, "User not found", http.StatusUnauthorized)
+			return
+		}
+
+		snapshots, err := snapshot.GetPlaylistSnapshots(userData.Id, chi.URLParam(r, "id"))
+		if err != nil {
+			log.Error("failed to get playlist snapshots", sl.Err(err))
+			render.JSON(w, r, resp.Error("failed to get playlist snapshots"))
+			return
+		}
+
+		render.JSON(w, r, Response{
+			Response:  resp.OK(),
+			Snapshots: snapshots,
+		})
+	}
+}
+
+// RestorePlaylistSnapshot puts the playlist back into the order recorded in
+// a snapshot. Only tracks added or removed since are added or removed, so the
+// rest keep their added_at dates, and local files and unavailable items stay
+// in the playlist. The current state is snapshotted first, so a restore can
+// itself be undone.
+func RestorePlaylistSnapshot(log *slog.Logger, user User, snapshot Snapshot, api *spotify.API) http.HandlerFunc {
+	type Response struct {
+		resp.Response
+		SnapshotId string `json:"snapshot_id"`
+		Moves      int    `json:"moves"`
+		BackupId   int64  `json:"backup_id"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.snapshot.RestorePlaylistSnapshot"
+		log := log.With(slog.String("op", op))
+
+		userData := jwtMiddleware.GetUserFromContext(r.Context())
+		if userData == nil {
+			http.Error(w, "User not found", http.StatusUnauthorized)
+			return
+		}
+
+		id := chi.URLParam(r, "id")
+
+		snapId, err := strconv.ParseInt(chi.URLParam(r, "snap"), 10, 64)
+		if err != nil {
+			log.Error("invalid snapshot id", sl.Err(err))
+			render.JSON(w, r, resp.Error("invalid snapshot id"))
+			return
+		}
+
+		saved, err := snapshot.GetPlaylistSnapshot(userData.Id, snapId)
+		if err != nil || saved.PlaylistId != id {
+			if err == nil || errors.Is(err, storage.ErrSnapshotNotFound) {
+				render.Status(r, http.StatusNotFound)
+				render.JSON(w, r, resp.NotFound("snapshot not found"))
+				return
+			}
+			log.Error("failed to get playlist snapshot", sl.Err(err))
+			render.JSON(w, r, resp.Error("failed to get playlist snapshot"))
+			return
+		}
+
+		client := api.NewClient(r.Context(), log, userData, user)
+
+		items, version, err := client.PlaylistItemsAt(id)
+		if err != nil {
+			log.Error("failed to get playlist items", sl.Err(err))
+			renderSpotifyError(w, r, err, "failed to get playlist items")
+			return
+		}
+
+		backup, err := snapshotPlaylist(snapshot, userData.Id, id, version, items)
+		if err != nil {
+			log.Error("failed to snapshot playlist", sl.Err(err))
+			renderSpotifyError(w, r, err, "failed to snapshot playlist")
+			return
+		}
+
+		snapshotId, moves, err := restorePlaylist(client, id, backup.SnapshotId, items, saved.TrackUris)
+		if err != nil {
+			log.Error("failed to restore playlist", sl.Err(err))
+			renderSpotifyError(w, r, err, "failed to restore playlist")
+			return
+		}
+
+		render.JSON(w, r, Response{
+			Response:   resp.OK(),
+			SnapshotId: snapshotId,
+			Moves:      moves,
+			BackupId:   backup.Id,
+		})
+	}
+}
+
+// snapshotPlaylist records items, the contents of the playlist at version
+// snapshotId, before the playlist is modified. The snapshot id should be
+// passed to the first mutating call so that it applies to exactly the
+// recorded version.
+func snapshotPlaylist(snapshot Snapshot, userId int64, playlistId, snapshotId string, items []userModel.PlaylistItem) (*userModel.PlaylistSnapshot, error) {
+	return snapshot.SavePlaylistSnapshot(userId, playlistId, snapshotId, itemUris(items))
+}
+
+// itemUris returns the URI of every item in playlist order. Local files keep
+// their spotify:local URI and unavailable items have an empty one, so that
+// their positions are recorded even though they cannot be added back.
+func itemUris(items []userModel.PlaylistItem) []string {
+	uris := make([]string, len(items))
+	for i, item := range items {
+		uris[i] = item.Track.Uri
+	}
+	return uris
+}
+
+// restorePlaylist turns the playlist, holding items at version snapshotId,
+// into saved. It returns the final snapshot id and the number of reorder
+// calls performed.
+func restorePlaylist(client *spotify.Client, playlistId, snapshotId string, items []userModel.PlaylistItem, saved []string) (string, int, error) {
+	current := itemUris(items)
+
+	remove, add := restoreChanges(current, saved)
+	if len(remove) > 0 || len(add) > 0 {
+		var err error
+		if len(remove) > 0 {
+			if snapshotId, err = client.RemoveItems(playlistId, remove, snapshotId); err != nil {
+				return "", 0, err
+			}
+		}
+		if len(add) > 0 {
+			if _, err = client.AddItems(playlistId, add, -1); err != nil {
+				return "", 0, err
+			}
+		}
+
+		if items, snapshotId, err = client.PlaylistItemsAt(playlistId); err != nil {
+			return "", 0, err
+		}
+		current = itemUris(items)
+	}
+
+	return reorderPlaylist(client, playlistId, snapshotId, restoreOrder(current, saved))
+}
+
+// restoreChanges returns the URIs to remove from and add to a playlist holding
+// current so that it holds the tracks of saved. RemoveItems drops every
+// occurrence of a URI, so a track the playlist holds more often than saved
+// is removed and then added back as often as saved holds it. Local files and
+// unavailable items are never removed or added.
+func restoreChanges(current, saved []string) (remove, add []string) {
+	have := make(map[string]int)
+	for _, uri := range current {
+		have[uri]++
+	}
+	want := make(map[string]int)
+	for _, uri := range saved {
+		want[uri]++
+	}
+
+	for _, uri := range current {
+		if addable(uri) && have[uri] > want[uri] {
+			remove = append(remove, uri)
+			have[uri] = 0
+		}
+	}
+
+	for _, uri := range saved {
+		if !addable(uri) {
+			continue
+		}
+		if have[uri] > 0 {
+			have[uri]--
+			continue
+		}
+		add = append(add, uri)
+	}
+
+	return remove, add
+}
+
+// restoreOrder returns the positions in current in the order of saved, the
+// n-th copy of a URI in saved taking the n-th copy in current. Items saved
+// does not hold follow in their current order.
+func restoreOrder(current, saved []string) []int {
+	positions := make(map[string][]int)
+	for i, uri := range current {
+		positions[uri] = append(positions[uri], i)
+	}
+
+	order := make([]int, 0, len(current))
+	placed := make([]bool, len(current))
+	for _, uri := range saved {
+		if p := positions[uri]; len(p) > 0 {
+			order = append(order, p[0])
+			placed[p[0]] = true
+			positions[uri] = p[1:]
+		}
+	}
+
+	for i := range current {
+		if !placed[i] {
+			order = append(order, i)
+		}
+	}
+
+	return order
+}
+
+// addable reports whether uri can be added to a playlist through the Web API.
+func addable(uri string) bool {
+	return uri != "" && !strings.HasPrefix(uri, "spotify:local:")
+}
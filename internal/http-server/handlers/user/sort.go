@@ -0,0 +1,221 @@
+package user
+
+import (
+	resp "SpotifySorter/internal/api/response"
+	jwtMiddleware "SpotifySorter/internal/http-server/middleware/jwt"
+	"SpotifySorter/internal/lib/client/spotify"
+	"SpotifySorter/internal/lib/client/spotify/reorder"
+	sl "SpotifySorter/internal/lib/logger/slog"
+	"SpotifySorter/internal/lib/sorter"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+	"log/slog"
+	"net/http"
+)
+
+type sortKey struct {
+	Key       string `json:"key" validate:"required,oneof=name artist album release_date added_at duration popularity disc_number track_number"`
+	Direction string `json:"direction" validate:"omitempty,oneof=asc desc"`
+}
+
+type sortRequest struct {
+	Key       string    `json:"key" validate:"required_without=Keys,omitempty,oneof=name artist album release_date added_at duration popularity disc_number track_number"`
+	Direction string    `json:"direction" validate:"omitempty,oneof=asc desc"`
+	Keys      []sortKey `json:"keys" validate:"omitempty,min=1,dive"`
+}
+
+// specs converts the request into sorter specs. A single key/direction pair
+// is shorthand for a one-element keys list.
+func (req sortRequest) specs() []sorter.Spec {
+	if len(req.Keys) == 0 {
+		return []sorter.Spec{{Key: sorter.Key(req.Key), Direction: req.Direction}}
+	}
+
+	specs := make([]sorter.Spec, len(req.Keys))
+	for i, key := range req.Keys {
+		specs[i] = sorter.Spec{Key: sorter.Key(key.Key), Direction: key.Direction}
+	}
+	return specs
+}
+
+func SortPlaylist(log *slog.Logger, user User, snapshot Snapshot, api *spotify.API) http.HandlerFunc {
+	type Response struct {
+		resp.Response
+		SnapshotId string `json:"snapshot_id"`
+		Moves      int    `json:"moves"`
+		BackupId   int64  `json:"backup_id"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.playlist.SortPlaylist"
+		log := log.With(slog.String("op", op))
+
+		userData := jwtMiddleware.GetUserFromContext(r.Context())
+		if userData == nil {
+			http.Error(w, "User not found", http.StatusUnauthorized)
+			return
+		}
+
+		var req sortRequest
+		if err := render.DecodeJSON(r.Body, &req); err != nil {
+			log.Error("failed to decode request", sl.Err(err))
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("failed to decode request"))
+			return
+		}
+
+		if err := validator.New().Struct(req); err != nil {
+			log.Error("invalid request", sl.Err(err))
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, resp.ValidationError(err.(validator.ValidationErrors)))
+			return
+		}
+
+		id := chi.URLParam(r, "id")
+		client := api.NewClient(r.Context(), log, userData, user)
+
+		items, version, err := client.PlaylistItemsAt(id)
+		if err != nil {
+			log.Error("failed to get playlist items", sl.Err(err))
+			renderSpotifyError(w, r, err, "failed to get playlist items")
+			return
+		}
+
+		order, err := sorter.OrderBy(items, req.specs())
+		if err != nil {
+			log.Error("failed to sort playlist", sl.Err(err))
+			render.JSON(w, r, resp.Error("failed to sort playlist"))
+			return
+		}
+
+		backup, err := snapshotPlaylist(snapshot, userData.Id, id, version, items)
+		if err != nil {
+			log.Error("failed to snapshot playlist", sl.Err(err))
+			renderSpotifyError(w, r, err, "failed to snapshot playlist")
+			return
+		}
+
+		snapshotId, moves, err := reorderPlaylist(client, id, backup.SnapshotId, order)
+		if err != nil {
+			log.Error("failed to reorder playlist", sl.Err(err))
+			renderSpotifyError(w, r, err, "failed to reorder playlist")
+			return
+		}
+
+		render.JSON(w, r, Response{
+			Response:   resp.OK(),
+			SnapshotId: snapshotId,
+			Moves:      moves,
+			BackupId:   backup.Id,
+		})
+	}
+}
+
+// PreviewSortPlaylist computes the same ordering as SortPlaylist but only
+// reports it; the playlist on Spotify is left untouched.
+func PreviewSortPlaylist(log *slog.Logger, user User, api *spotify.API) http.HandlerFunc {
+	type Track struct {
+		Uri     string   `json:"uri"`
+		Name    string   `json:"name"`
+		Artists []string `json:"artists"`
+		Album   string   `json:"album"`
+		Before  int      `json:"before"`
+		After   int      `json:"after"`
+	}
+	type Response struct {
+		resp.Response
+		Tracks []Track        `json:"tracks"`
+		Moves  []reorder.Move `json:"moves"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.playlist.PreviewSortPlaylist"
+		log := log.With(slog.String("op", op))
+
+		userData := jwtMiddleware.GetUserFromContext(r.Context())
+		if userData == nil {
+			http.Error(w, "User not found", http.StatusUnauthorized)
+			return
+		}
+
+		var req sortRequest
+		if err := render.DecodeJSON(r.Body, &req); err != nil {
+			log.Error("failed to decode request", sl.Err(err))
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("failed to decode request"))
+			return
+		}
+
+		if err := validator.New().Struct(req); err != nil {
+			log.Error("invalid request", sl.Err(err))
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, resp.ValidationError(err.(validator.ValidationErrors)))
+			return
+		}
+
+		id := chi.URLParam(r, "id")
+		client := api.NewClient(r.Context(), log, userData, user)
+
+		items, err := client.PlaylistItems(id)
+		if err != nil {
+			log.Error("failed to get playlist items", sl.Err(err))
+			renderSpotifyError(w, r, err, "failed to get playlist items")
+			return
+		}
+
+		order, err := sorter.OrderBy(items, req.specs())
+		if err != nil {
+			log.Error("failed to sort playlist", sl.Err(err))
+			render.JSON(w, r, resp.Error("failed to sort playlist"))
+			return
+		}
+
+		moves, err := reorder.Plan(order)
+		if err != nil {
+			log.Error("failed to plan reorder", sl.Err(err))
+			render.JSON(w, r, resp.Error("failed to plan reorder"))
+			return
+		}
+
+		tracks := make([]Track, len(order))
+		for after, before := range order {
+			track := items[before].Track
+
+			artists := make([]string, len(track.Artists))
+			for i, artist := range track.Artists {
+				artists[i] = artist.Name
+			}
+
+			tracks[after] = Track{
+				Uri:     track.Uri,
+				Name:    track.Name,
+				Artists: artists,
+				Album:   track.Album.Name,
+				Before:  before,
+				After:   after,
+			}
+		}
+
+		render.JSON(w, r, Response{
+			Response: resp.OK(),
+			Tracks:   tracks,
+			Moves:    moves,
+		})
+	}
+}
+
+// reorderPlaylist writes order back to Spotify, where order lists current
+// positions in their target order and snapshotId identifies the playlist
+// version they refer to. It returns the final snapshot id and the number of
+// reorder calls performed.
+func reorderPlaylist(client *spotify.Client, playlistId, snapshotId string, order []int) (string, int, error) {
+	moves, err := reorder.Plan(order)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return reorder.Execute(moves, snapshotId, func(move reorder.Move, snapshotId string) (string, error) {
+		return client.ReorderItems(playlistId, move.RangeStart, move.InsertBefore, move.RangeLength, snapshotId)
+	})
+}
@@ -0,0 +1,165 @@
+package user
+
+import (
+	resp "SpotifySorter/internal/api/response"
+	jwtMiddleware "SpotifySorter/internal/http-server/middleware/jwt"
+	"SpotifySorter/internal/lib/client/spotify"
+	sl "SpotifySorter/internal/lib/logger/slog"
+	"SpotifySorter/internal/lib/split"
+	userModel "SpotifySorter/models"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+	"log/slog"
+	"net/http"
+)
+
+// maxSplitPlaylists caps how many playlists a single split may create.
+const maxSplitPlaylists = 50
+
+// SplitPlaylist creates one new playlist per group of the playlist's tracks.
+// The source playlist is left unchanged. If Spotify fails part way, the error
+// response still lists the playlists created so far, so that they can be
+// found and removed; the one being filled is marked incomplete.
+func SplitPlaylist(log *slog.Logger, user User, api *spotify.API) http.HandlerFunc {
+	type Request struct {
+		Key       string `json:"key" validate:"required,oneof=decade artist album_type explicit added_month"`
+		Template  string `json:"template" validate:"omitempty,contains={group},max=100"`
+		Public    *bool  `json:"public"`
+		MinTracks int    `json:"min_tracks" validate:"omitempty,min=1"`
+	}
+	type Playlist struct {
+		Id     string `json:"id"`
+		Name   string `json:"name"`
+		Group  string `json:"group"`
+		Tracks int    `json:"tracks"`
+		// Incomplete is set on a playlist whose tracks failed to be added.
+		Incomplete bool `json:"incomplete,omitempty"`
+	}
+	type Response struct {
+		resp.Response
+		Playlists []Playlist `json:"playlists"`
+		Skipped   int        `json:"skipped_groups"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.split.SplitPlaylist"
+		log := log.With(slog.String("op", op))
+
+		userData := jwtMiddleware.GetUserFromContext(r.Context())
+		if userData == nil {
+			http.Error(w, "User not found", http.StatusUnauthorized)
+			return
+		}
+
+		var req Request
+		if err := render.DecodeJSON(r.Body, &req); err != nil {
+			log.Error("failed to decode request", sl.Err(err))
+			render.JSON(w, r, resp.Error("failed to decode request"))
+			return
+		}
+
+		if err := validator.New().Struct(req); err != nil {
+			log.Error("invalid request", sl.Err(err))
+			render.JSON(w, r, resp.ValidationError(err.(validator.ValidationErrors)))
+			return
+		}
+
+		if req.Template == "" {
+			req.Template = split.DefaultTemplate
+		}
+		if req.MinTracks == 0 {
+			req.MinTracks = 1
+		}
+
+		id := chi.URLParam(r, "id")
+		client := api.NewClient(r.Context(), log, userData, user)
+
+		source, err := client.Playlist(id)
+		if err != nil {
+			log.Error("failed to get playlist", sl.Err(err))
+			renderSpotifyError(w, r, err, "failed to get playlist")
+			return
+		}
+
+		items, err := client.PlaylistItems(id)
+		if err != nil {
+			log.Error("failed to get playlist items", sl.Err(err))
+			renderSpotifyError(w, r, err, "failed to get playlist items")
+			return
+		}
+
+		groups, err := split.ByKey(items, split.Key(req.Key))
+		if err != nil {
+			log.Error("failed to group playlist", sl.Err(err))
+			render.JSON(w, r, resp.Error("failed to group playlist"))
+			return
+		}
+
+		var kept []split.Group
+		for _, group := range groups {
+			if len(playlistUris(items, group.Positions)) >= req.MinTracks {
+				kept = append(kept, group)
+			}
+		}
+
+		if len(kept) > maxSplitPlaylists {
+			render.JSON(w, r, resp.Error(fmt.Sprintf("split would create %d playlists, at most %d are allowed; raise min_tracks", len(kept), maxSplitPlaylists)))
+			return
+		}
+
+		created := make([]Playlist, 0, len(kept))
+		fail := func(err error, msg string) {
+			render.JSON(w, r, Response{
+				Response:  spotifyError(w, r, err, msg),
+				Playlists: created,
+				Skipped:   len(groups) - len(kept),
+			})
+		}
+
+		for _, group := range kept {
+			name := split.Name(req.Template, source.Name, group.Name)
+			uris := playlistUris(items, group.Positions)
+
+			playlist, err := client.CreatePlaylist(userData.IdSpotify, userModel.PlaylistDetails{
+				Name:        name,
+				Public:      req.Public,
+				Description: "Split from " + source.Name,
+			})
+			if err != nil {
+				log.Error("failed to create playlist", slog.String("name", name), sl.Err(err))
+				fail(err, "failed to create playlist")
+				return
+			}
+
+			if _, err := client.AddItems(playlist.Id, uris, -1); err != nil {
+				log.Error("failed to add items", slog.String("playlist", playlist.Id), sl.Err(err))
+				created = append(created, Playlist{Id: playlist.Id, Name: name, Group: group.Name, Incomplete: true})
+				fail(err, "failed to add items")
+				return
+			}
+
+			created = append(created, Playlist{Id: playlist.Id, Name: name, Group: group.Name, Tracks: len(uris)})
+		}
+
+		render.JSON(w, r, Response{
+			Response:  resp.OK(),
+			Playlists: created,
+			Skipped:   len(groups) - len(kept),
+		})
+	}
+}
+
+// playlistUris returns the URIs of the items at positions that can be added
+// through the Web API, which excludes local files.
+func playlistUris(items []userModel.PlaylistItem, positions []int) []string {
+	uris := make([]string, 0, len(positions))
+	for _, position := range positions {
+		item := &items[position]
+		if item.Track.Uri != "" && !item.IsLocal {
+			uris = append(uris, item.Track.Uri)
+		}
+	}
+	return uris
+}
@@ -0,0 +1,194 @@
+package user
+
+import (
+	resp "SpotifySorter/internal/api/response"
+	jwtMiddleware "SpotifySorter/internal/http-server/middleware/jwt"
+	sl "SpotifySorter/internal/lib/logger/slog"
+	"SpotifySorter/internal/storage"
+	userModel "SpotifySorter/models"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+	"github.com/golang-jwt/jwt/v4"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+type RefreshTokens interface {
+	SaveRefreshToken(userId int64, familyId, tokenHash string, expiresAt time.Time) error
+	GetRefreshToken(tokenHash string) (*userModel.RefreshToken, error)
+	UseRefreshToken(id int64) (bool, error)
+}
+
+// TokenSigner signs access tokens.
+type TokenSigner interface {
+	Sign(claims jwt.Claims) (string, error)
+}
+
+// TokenIssuer configures the access and refresh tokens issued to API
+// clients.
+type TokenIssuer struct {
+	Signer     TokenSigner
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+}
+
+// RefreshAccessToken exchanges a refresh token for a new access token and a
+// new refresh token. Each refresh token works once: presenting it again
+// revokes its session, logging out both the thief and the victim.
+func RefreshAccessToken(log *slog.Logger, refreshTokens RefreshTokens, sessions Sessions, issuer TokenIssuer) http.HandlerFunc {
+	type Request struct {
+		RefreshToken string `json:"refresh_token" validate:"required"`
+	}
+	type Response struct {
+		resp.Response
+		userModel.Tokens
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.user.RefreshAccessToken"
+		log := log.With(slog.String("op", op))
+
+		var req Request
+		if err := render.DecodeJSON(r.Body, &req); err != nil {
+			log.Error("failed to decode request", sl.Err(err))
+			render.JSON(w, r, resp.Error("failed to decode request"))
+			return
+		}
+
+		if err := validator.New().Struct(req); err != nil {
+			log.Error("invalid request", sl.Err(err))
+			render.JSON(w, r, resp.ValidationError(err.(validator.ValidationErrors)))
+			return
+		}
+
+		token, err := refreshTokens.GetRefreshToken(hashToken(req.RefreshToken))
+		if err != nil {
+			if errors.Is(err, storage.ErrTokenNotFound) {
+				render.Status(r, http.StatusUnauthorized)
+				render.JSON(w, r, resp.Unauthorized("invalid refresh token"))
+				return
+			}
+			log.Error("failed to get refresh token", sl.Err(err))
+			render.JSON(w, r, resp.Error("failed to refresh token"))
+			return
+		}
+
+		if token.RevokedAt != nil {
+			render.Status(r, http.StatusUnauthorized)
+			render.JSON(w, r, resp.Unauthorized("invalid refresh token"))
+			return
+		}
+
+		if time.Now().After(token.ExpiresAt) {
+			render.Status(r, http.StatusUnauthorized)
+			render.JSON(w, r, resp.Unauthorized("refresh token expired"))
+			return
+		}
+
+		// A used token was either replayed or is racing its own refresh;
+		// both mean it may be stolen.
+		fresh := token.UsedAt == nil
+		if fresh {
+			fresh, err = refreshTokens.UseRefreshToken(token.Id)
+			if err != nil {
+				log.Error("failed to use refresh token", sl.Err(err))
+				render.JSON(w, r, resp.Error("failed to refresh token"))
+				return
+			}
+		}
+
+		if !fresh {
+			log.Warn("refresh token reused, revoking session",
+				slog.Int64("user_id", token.UserId), slog.String("session_id", token.FamilyId))
+
+			err := sessions.RevokeSession(token.UserId, token.FamilyId)
+			if err != nil && !errors.Is(err, storage.ErrSessionNotFound) {
+				log.Error("failed to revoke session", sl.Err(err))
+			}
+
+			render.Status(r, http.StatusUnauthorized)
+			render.JSON(w, r, resp.Unauthorized("invalid refresh token"))
+			return
+		}
+
+		session, err := sessions.GetSession(token.FamilyId)
+		if err != nil {
+			if errors.Is(err, storage.ErrSessionNotFound) {
+				render.Status(r, http.StatusUnauthorized)
+				render.JSON(w, r, resp.Unauthorized("invalid refresh token"))
+				return
+			}
+			log.Error("failed to get session", sl.Err(err))
+			render.JSON(w, r, resp.Error("failed to refresh token"))
+			return
+		}
+
+		if session.RevokedAt != nil {
+			render.Status(r, http.StatusUnauthorized)
+			render.JSON(w, r, resp.Unauthorized("invalid refresh token"))
+			return
+		}
+
+		if err := sessions.TouchSession(session.Id, jwtMiddleware.ClientIp(r)); err != nil {
+			log.Error("failed to touch session", sl.Err(err))
+		}
+
+		tokens, err := issueTokens(refreshTokens, token.UserId, session.Id, issuer)
+		if err != nil {
+			log.Error("failed to issue tokens", sl.Err(err))
+			render.JSON(w, r, resp.Error("failed to refresh token"))
+			return
+		}
+
+		render.JSON(w, r, Response{
+			Response: resp.OK(),
+			Tokens:   *tokens,
+		})
+	}
+}
+
+// issueTokens issues an access token and a refresh token of the session.
+func issueTokens(refreshTokens RefreshTokens, userId int64, sessionId string, issuer TokenIssuer) (*userModel.Tokens, error) {
+	accessToken, err := GenerateToken(issuer.Signer, userId, sessionId, issuer.AccessTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	err = refreshTokens.SaveRefreshToken(userId, sessionId, hashToken(refreshToken), time.Now().Add(issuer.RefreshTTL))
+	if err != nil {
+		return nil, err
+	}
+
+	return &userModel.Tokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(issuer.AccessTTL / time.Second),
+	}, nil
+}
+
+// randomToken returns n random bytes, base64url encoded.
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the hex SHA-256 of a refresh token, the form in which it
+// is stored. Refresh tokens are random, so a plain hash is enough.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
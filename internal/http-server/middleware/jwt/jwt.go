@@ -4,20 +4,42 @@ import (
 	resp "SpotifySorter/internal/api/response"
 	userModel "SpotifySorter/models"
 	"context"
+	"errors"
+	"net"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/go-chi/render"
 	"github.com/golang-jwt/jwt/v4"
 )
 
 type User interface {
-	GetUserByAccessToken(accessToken string) (*userModel.User, error)
+	GetUserById(id int64) (*userModel.User, error)
 }
 
-const UserContextKey = "user"
+// Keys verify access tokens.
+type Keys interface {
+	Keyfunc(token *jwt.Token) (any, error)
+	Methods() []string
+}
+
+type Sessions interface {
+	GetSession(id string) (*userModel.Session, error)
+	TouchSession(id, ip string) error
+}
+
+const (
+	UserContextKey    = "user"
+	SessionContextKey = "session"
+)
+
+// touchInterval limits how often a session's last seen time is written.
+const touchInterval = time.Minute
+
+var errInvalidClaims = errors.New("invalid claims")
 
-func JWTMiddleware(secret string, user User) func(next http.Handler) http.Handler {
+func JWTMiddleware(keys Keys, user User, sessions Sessions) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Извлекаем токен из заголовка Authorization
@@ -38,13 +60,7 @@ func JWTMiddleware(secret string, user User) func(next http.Handler) http.Handle
 
 			// Проверяем валидность токена
 			claims := &userModel.Claims{}
-			_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-				// Проверяем алгоритм подписи
-				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-					return nil, jwt.NewValidationError("unexpected signing method", jwt.ValidationErrorMalformed)
-				}
-				return []byte(secret), nil
-			})
+			_, err := jwt.ParseWithClaims(tokenString, claims, keys.Keyfunc, jwt.WithValidMethods(keys.Methods()))
 
 			if err != nil {
 				if ve, ok := err.(*jwt.ValidationError); ok {
@@ -59,8 +75,25 @@ func JWTMiddleware(secret string, user User) func(next http.Handler) http.Handle
 				return
 			}
 
+			userId, err := validateClaims(claims)
+			if err != nil {
+				render.JSON(w, r, resp.Unauthorized("invalid token"))
+				return
+			}
+
+			// Отклоняем токены отозванных сессий
+			session, err := sessions.GetSession(claims.SessionId)
+			if err != nil || session.UserId != userId || session.RevokedAt != nil {
+				render.JSON(w, r, resp.Unauthorized("session revoked"))
+				return
+			}
+
+			if time.Since(session.LastSeenAt) > touchInterval {
+				_ = sessions.TouchSession(session.Id, ClientIp(r))
+			}
+
 			// Добавляем данные о пользователе в контекст запроса
-			user, err := user.GetUserByAccessToken(tokenString)
+			user, err := user.GetUserById(userId)
 			if err != nil {
 				render.JSON(w, r, resp.Unauthorized("Unauthorized"))
 				return
@@ -68,12 +101,47 @@ func JWTMiddleware(secret string, user User) func(next http.Handler) http.Handle
 
 			// Set user in request context
 			ctx := context.WithValue(r.Context(), UserContextKey, user)
+			ctx = context.WithValue(ctx, SessionContextKey, session.Id)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
+// validateClaims checks the claims jwt.ParseWithClaims leaves optional: the
+// token must name this backend as issuer and audience, carry its issue time,
+// id and session, and have a user id as subject. It returns the user id.
+func validateClaims(claims *userModel.Claims) (int64, error) {
+	if !claims.VerifyIssuer(userModel.TokenIssuer, true) ||
+		!claims.VerifyAudience(userModel.TokenAudience, true) ||
+		claims.IssuedAt == nil || claims.ExpiresAt == nil || claims.ID == "" || claims.SessionId == "" {
+		return 0, errInvalidClaims
+	}
+
+	userId, err := claims.UserId()
+	if err != nil {
+		return 0, errInvalidClaims
+	}
+
+	return userId, nil
+}
+
 func GetUserFromContext(ctx context.Context) *userModel.User {
 	user, _ := ctx.Value(UserContextKey).(*userModel.User)
 	return user
 }
+
+// GetSessionFromContext returns the id of the session the request's access
+// token was issued to.
+func GetSessionFromContext(ctx context.Context) string {
+	session, _ := ctx.Value(SessionContextKey).(string)
+	return session
+}
+
+// ClientIp returns the IP address the request came from.
+func ClientIp(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
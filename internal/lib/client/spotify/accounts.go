@@ -0,0 +1,111 @@
+package spotify
+
+import (
+	sl "SpotifySorter/internal/lib/logger/slog"
+	userModel "SpotifySorter/models"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Scopes are the permissions the backend asks users for.
+var Scopes = []string{
+	"user-read-email",
+	"user-read-private",
+	"user-library-read",
+	"playlist-read-private",
+	"playlist-read-collaborative",
+	"playlist-modify-public",
+	"playlist-modify-private",
+}
+
+// AuthorizeURL returns the URL that asks the user to grant Scopes to the app.
+// Spotify redirects back with state and an authorization code bound to the
+// S256 PKCE challenge.
+func (a *API) AuthorizeURL(state, challenge string) string {
+	query := url.Values{}
+	query.Set("client_id", os.Getenv("SPOTIFY_CLIENT_ID"))
+	query.Set("response_type", "code")
+	query.Set("redirect_uri", os.Getenv("SPOTIFY_REDIRECT_URI"))
+	query.Set("scope", strings.Join(Scopes, " "))
+	query.Set("state", state)
+	query.Set("code_challenge_method", "S256")
+	query.Set("code_challenge", challenge)
+
+	return a.accountsURL + "authorize?" + query.Encode()
+}
+
+// ExchangeCode exchanges an authorization code for access and refresh tokens.
+// verifier is the PKCE code verifier of the login that requested the code.
+func (a *API) ExchangeCode(ctx context.Context, log *slog.Logger, code, verifier string) (*userModel.AccessTokensByCode, error) {
+	data := url.Values{}
+	data.Set("code", code)
+	data.Set("redirect_uri", os.Getenv("SPOTIFY_REDIRECT_URI"))
+	data.Set("grant_type", "authorization_code")
+	data.Set("code_verifier", verifier)
+
+	return a.requestToken(ctx, log, data)
+}
+
+// RefreshToken obtains a new access token using a refresh token. The returned
+// refresh token is empty unless Spotify rotated it.
+func (a *API) RefreshToken(ctx context.Context, log *slog.Logger, refreshToken string) (*userModel.AccessTokensByCode, error) {
+	data := url.Values{}
+	data.Set("refresh_token", refreshToken)
+	data.Set("grant_type", "refresh_token")
+
+	return a.requestToken(ctx, log, data)
+}
+
+func (a *API) requestToken(ctx context.Context, log *slog.Logger, data url.Values) (*userModel.AccessTokensByCode, error) {
+	reqToSpotify, err := http.NewRequestWithContext(ctx, "POST", a.accountsURL+"api/token", strings.NewReader(data.Encode()))
+	if err != nil {
+		log.Error("failed to create request", sl.Err(err))
+		return nil, errors.New("failed to create request")
+	}
+
+	clientID := os.Getenv("SPOTIFY_CLIENT_ID")
+	clientSecret := os.Getenv("SPOTIFY_CLIENT_SECRET")
+	if clientID == "" || clientSecret == "" {
+		log.Error("SPOTIFY_CLIENT_ID or SPOTIFY_CLIENT_SECRET is not set")
+		return nil, errors.New("SPOTIFY_CLIENT_ID or SPOTIFY_CLIENT_SECRET is not set")
+	}
+	auth := clientID + ":" + clientSecret
+	encodedAuth := base64.StdEncoding.EncodeToString([]byte(auth))
+	reqToSpotify.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	reqToSpotify.Header.Set("Authorization", "Basic "+encodedAuth)
+
+	resp, err := a.httpClient.Do(reqToSpotify)
+	if err != nil {
+		log.Error("failed to send request to Spotify", sl.Err(err))
+		return nil, errors.New("failed to send request to Spotify")
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Error("failed to read response body", sl.Err(err))
+		return nil, errors.New("failed to read response body")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		apiErr := decodeTokenError(resp.StatusCode, body)
+		log.Error("token request rejected", slog.Int("status", resp.StatusCode), slog.String("message", apiErr.Message))
+		return nil, apiErr
+	}
+
+	var tokens userModel.AccessTokensByCode
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		log.Error("failed to decode response from Spotify", sl.Err(err))
+		return nil, errors.New("failed to decode response from Spotify")
+	}
+
+	return &tokens, nil
+}
@@ -0,0 +1,143 @@
+package spotify
+
+import (
+	userModel "SpotifySorter/models"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// refreshBefore is how long before its expiry an access token is refreshed.
+const refreshBefore = time.Minute
+
+type TokenStorage interface {
+	UpdateSpotifyTokens(userId int64, accessToken, refreshToken string, expiresAt time.Time) error
+}
+
+// Client sends Web API requests on behalf of a user. It refreshes the user's
+// access token when it is about to expire or is rejected by Spotify, and
+// saves the new token through the token storage.
+type Client struct {
+	api    *API
+	ctx    context.Context
+	log    *slog.Logger
+	tokens TokenStorage
+
+	mu   sync.Mutex
+	user *userModel.User
+}
+
+// NewClient returns a client acting for user. Its requests, and the waits
+// for the rate limiters, are cancelled when ctx is done. tokens may be nil
+// when the user has no refresh token, e.g. during login.
+func (a *API) NewClient(ctx context.Context, log *slog.Logger, user *userModel.User, tokens TokenStorage) *Client {
+	return &Client{
+		api:    a,
+		ctx:    ctx,
+		log:    log,
+		tokens: tokens,
+		user:   user,
+	}
+}
+
+func (c *Client) Get(endpoint string) ([]byte, error) {
+	return c.Send(http.MethodGet, endpoint, nil)
+}
+
+func (c *Client) Send(method, endpoint string, payload any) ([]byte, error) {
+	return c.send(method, endpoint, payload, idempotent(method))
+}
+
+// send sends a request, retrying server errors only if retry is set.
+func (c *Client) send(method, endpoint string, payload any, retry bool) ([]byte, error) {
+	if err := c.wait(); err != nil {
+		return nil, err
+	}
+
+	accessToken, err := c.accessToken()
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := c.api.send(c.ctx, c.log, method, accessToken, endpoint, payload, retry)
+	if !errors.Is(err, ErrUnauthorized) {
+		return response, err
+	}
+
+	accessToken, err = c.refresh(accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.wait(); err != nil {
+		return nil, err
+	}
+
+	return c.api.send(c.ctx, c.log, method, accessToken, endpoint, payload, retry)
+}
+
+// wait blocks until both the user's and the application's rate limits allow
+// another request, or until the client's context is done.
+func (c *Client) wait() error {
+	if c.user.Id != 0 {
+		if err := c.api.userLimiter(c.user.Id).Wait(c.ctx); err != nil {
+			return err
+		}
+	}
+	return c.api.globalLimiter.Wait(c.ctx)
+}
+
+// accessToken returns the user's access token, refreshing it first if it is
+// about to expire.
+func (c *Client) accessToken() (string, error) {
+	c.mu.Lock()
+	accessToken := c.user.SpotifyAccessToken
+	expiresAt := c.user.SpotifyTokenExpiresAt
+	c.mu.Unlock()
+
+	if expiresAt.IsZero() || time.Until(expiresAt) > refreshBefore {
+		return accessToken, nil
+	}
+
+	return c.refresh(accessToken)
+}
+
+// refresh replaces the expired token with a new one. If another request has
+// already refreshed it in the meantime, that token is returned instead.
+func (c *Client) refresh(expired string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.user.SpotifyAccessToken != expired {
+		return c.user.SpotifyAccessToken, nil
+	}
+
+	if c.user.SpotifyRefreshToken == "" {
+		return "", ErrUnauthorized
+	}
+
+	tokens, err := c.api.RefreshToken(c.ctx, c.log, c.user.SpotifyRefreshToken)
+	if err != nil {
+		return "", fmt.Errorf("failed to refresh access token: %w", err)
+	}
+
+	expiresAt := time.Now().Add(time.Duration(tokens.ExpiresIn) * time.Second)
+
+	if err := c.tokens.UpdateSpotifyTokens(c.user.Id, tokens.AccessToken, tokens.RefreshToken, expiresAt); err != nil {
+		return "", fmt.Errorf("failed to save refreshed access token: %w", err)
+	}
+
+	c.user.SpotifyAccessToken = tokens.AccessToken
+	if tokens.RefreshToken != "" {
+		c.user.SpotifyRefreshToken = tokens.RefreshToken
+	}
+	c.user.SpotifyTokenExpiresAt = expiresAt
+
+	c.log.Info("spotify access token refreshed", slog.Int64("user_id", c.user.Id))
+
+	return tokens.AccessToken, nil
+}
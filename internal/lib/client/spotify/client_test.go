@@ -0,0 +1,244 @@
+package spotify_test
+
+import (
+	"SpotifySorter/internal/lib/client/spotify"
+	"SpotifySorter/internal/lib/client/spotify/reorder"
+	"SpotifySorter/internal/lib/client/spotify/spotifytest"
+	"SpotifySorter/internal/lib/sorter"
+	userModel "SpotifySorter/models"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+const userId = "alice"
+
+// tokenStore records the tokens a client saves after refreshing.
+type tokenStore struct {
+	accessToken  string
+	refreshToken string
+}
+
+func (t *tokenStore) UpdateSpotifyTokens(_ int64, accessToken, refreshToken string, _ time.Time) error {
+	t.accessToken = accessToken
+	t.refreshToken = refreshToken
+	return nil
+}
+
+// newClient starts a fake Spotify with one user and returns a client acting
+// for that user, the user and the store the client saves tokens to.
+func newClient(t *testing.T) (*spotifytest.Server, *spotify.Client, *userModel.User, *tokenStore) {
+	t.Helper()
+
+	server := spotifytest.NewServer()
+	t.Cleanup(server.Close)
+
+	server.AddUser(spotifytest.User{Id: userId, DisplayName: "Alice", Email: "alice@example.com"})
+	accessToken, refreshToken := server.IssueTokens(userId)
+
+	user := &userModel.User{
+		Id:                  1,
+		IdSpotify:           userId,
+		SpotifyAccessToken:  accessToken,
+		SpotifyRefreshToken: refreshToken,
+	}
+	tokens := &tokenStore{}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	return server, server.API().NewClient(context.Background(), log, user, tokens), user, tokens
+}
+
+// addTracks adds n tracks named "Track 001" and so on and returns their URIs.
+func addTracks(server *spotifytest.Server, n int) []string {
+	tracks := make([]userModel.Track, n)
+	for i := range tracks {
+		tracks[i].Name = fmt.Sprintf("Track %03d", i+1)
+	}
+
+	uris := make([]string, n)
+	for i, track := range server.AddTracks(tracks...) {
+		uris[i] = track.Uri
+	}
+	return uris
+}
+
+func TestPagination(t *testing.T) {
+	server, client, _, _ := newClient(t)
+
+	uris := addTracks(server, 250)
+	playlistId := server.AddPlaylist(userId, "Big", uris...)
+	for i := range 120 {
+		server.AddPlaylist(userId, fmt.Sprintf("Playlist %d", i))
+	}
+
+	items, err := client.PlaylistItems(playlistId)
+	if err != nil {
+		t.Fatalf("PlaylistItems: %v", err)
+	}
+
+	got := make([]string, len(items))
+	for i, item := range items {
+		got[i] = item.Track.Uri
+	}
+	if !slices.Equal(got, uris) {
+		t.Errorf("PlaylistItems returned %d items out of order, want all %d in order", len(got), len(uris))
+	}
+	if n := server.CountRequests(http.MethodGet, "playlists/"+playlistId+"/tracks"); n != 3 {
+		t.Errorf("PlaylistItems sent %d requests, want 3 pages of 100", n)
+	}
+
+	playlists, err := client.UserPlaylists(userId)
+	if err != nil {
+		t.Fatalf("UserPlaylists: %v", err)
+	}
+	if len(playlists) != 121 {
+		t.Errorf("UserPlaylists returned %d playlists, want 121", len(playlists))
+	}
+	if n := server.CountRequests(http.MethodGet, "users/"+userId+"/playlists"); n != 3 {
+		t.Errorf("UserPlaylists sent %d requests, want 3 pages of 50", n)
+	}
+}
+
+func TestSortAndReorder(t *testing.T) {
+	server, client, _, _ := newClient(t)
+
+	uris := addTracks(server, 150)
+	shuffled := slices.Clone(uris)
+	for i := range shuffled {
+		j := (i*37 + 11) % len(shuffled)
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	}
+	playlistId := server.AddPlaylist(userId, "Shuffled", shuffled...)
+
+	items, snapshotId, err := client.PlaylistItemsAt(playlistId)
+	if err != nil {
+		t.Fatalf("PlaylistItemsAt: %v", err)
+	}
+
+	order, err := sorter.OrderBy(items, []sorter.Spec{{Key: sorter.KeyName, Direction: sorter.DirectionAsc}})
+	if err != nil {
+		t.Fatalf("OrderBy: %v", err)
+	}
+
+	moves, err := reorder.Plan(order)
+	if err != nil {
+		t.Fatalf("Plan: %v", err)
+	}
+
+	// The fake rejects a stale snapshot id, so this also checks that every
+	// move is sent with the id returned by the one before.
+	_, calls, err := reorder.Execute(moves, snapshotId, func(move reorder.Move, snapshotId string) (string, error) {
+		return client.ReorderItems(playlistId, move.RangeStart, move.InsertBefore, move.RangeLength, snapshotId)
+	})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+
+	if got := server.PlaylistUris(playlistId); !slices.Equal(got, uris) {
+		t.Errorf("playlist is not sorted by name after %d moves", calls)
+	}
+	if n := server.CountRequests(http.MethodPut, "playlists/"+playlistId+"/tracks"); n != calls {
+		t.Errorf("sent %d reorder requests, Execute reported %d", n, calls)
+	}
+}
+
+func TestRefreshOnUnauthorized(t *testing.T) {
+	t.Setenv("SPOTIFY_CLIENT_ID", "client")
+	t.Setenv("SPOTIFY_CLIENT_SECRET", "secret")
+
+	server, client, user, tokens := newClient(t)
+
+	expired := user.SpotifyAccessToken
+	server.ExpireAccessToken(expired)
+
+	if _, err := client.CurrentUser(); err != nil {
+		t.Fatalf("CurrentUser after the access token expired: %v", err)
+	}
+	if tokens.accessToken == "" || tokens.accessToken == expired {
+		t.Errorf("saved access token %q, want a refreshed one", tokens.accessToken)
+	}
+	if n := server.CountRequests(http.MethodGet, "me"); n != 2 {
+		t.Errorf("sent %d requests, want the rejected one and a retry", n)
+	}
+}
+
+func TestRetryAfterRateLimit(t *testing.T) {
+	server, client, _, _ := newClient(t)
+
+	server.InjectFault(spotifytest.Fault{Method: http.MethodGet, Path: "me", Status: http.StatusTooManyRequests, RetryAfter: time.Second})
+
+	start := time.Now()
+	if _, err := client.CurrentUser(); err != nil {
+		t.Fatalf("CurrentUser: %v", err)
+	}
+
+	if n := server.CountRequests(http.MethodGet, "me"); n != 2 {
+		t.Errorf("sent %d requests, want the rate limited one and a retry", n)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %s, want at least the Retry-After of 1s", elapsed)
+	}
+}
+
+func TestRetryOnServerError(t *testing.T) {
+	server, client, _, _ := newClient(t)
+
+	uris := addTracks(server, 3)
+	playlistId := server.AddPlaylist(userId, "Playlist", uris...)
+
+	server.InjectFault(spotifytest.Fault{Method: http.MethodGet, Path: "me", Status: http.StatusBadGateway})
+	if _, err := client.CurrentUser(); err != nil {
+		t.Fatalf("CurrentUser: %v", err)
+	}
+
+	// A POST may have been applied before the server failed, so it is not
+	// sent again.
+	server.InjectFault(spotifytest.Fault{Method: http.MethodPost, Path: "playlists/", Status: http.StatusBadGateway})
+	if _, err := client.AddItems(playlistId, uris[:1], -1); err == nil {
+		t.Fatal("AddItems succeeded, want the server error")
+	}
+	if n := server.CountRequests(http.MethodPost, "playlists/"+playlistId+"/tracks"); n != 1 {
+		t.Errorf("sent %d POST requests, want 1", n)
+	}
+
+	// A range move is a PUT but not idempotent either.
+	server.InjectFault(spotifytest.Fault{Method: http.MethodPut, Path: "playlists/", Status: http.StatusBadGateway})
+	if _, err := client.ReorderItems(playlistId, 0, 2, 1, ""); err == nil {
+		t.Fatal("ReorderItems succeeded, want the server error")
+	}
+	if n := server.CountRequests(http.MethodPut, "playlists/"+playlistId+"/tracks"); n != 1 {
+		t.Errorf("sent %d PUT requests, want 1", n)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	server, _, _, _ := newClient(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	api := server.API()
+	api.SetRateLimits(1, 1, 1, 1)
+
+	accessToken, _ := server.IssueTokens(userId)
+	client := api.NewClient(ctx, slog.New(slog.NewTextHandler(io.Discard, nil)), &userModel.User{Id: 1, SpotifyAccessToken: accessToken}, nil)
+
+	if _, err := client.CurrentUser(); err != nil {
+		t.Fatalf("CurrentUser: %v", err)
+	}
+
+	// The limiter is empty now, so the next request waits for a second
+	// unless it is cancelled.
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	if _, err := client.CurrentUser(); err != context.Canceled {
+		t.Fatalf("CurrentUser returned %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("cancelled request returned after %s", elapsed)
+	}
+}
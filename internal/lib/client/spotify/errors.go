@@ -0,0 +1,95 @@
+package spotify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+var (
+	ErrUnauthorized = errors.New("spotify: unauthorized")
+	ErrForbidden    = errors.New("spotify: forbidden")
+	ErrNotFound     = errors.New("spotify: not found")
+	// ErrPlaylistChanged is returned when a playlist keeps changing while
+	// its items are read, so they cannot be tied to a single version.
+	ErrPlaylistChanged = errors.New("spotify: playlist changed while it was read")
+)
+
+// ErrRateLimited is returned when Spotify keeps rejecting a request with 429
+// Too Many Requests. RetryAfter is the wait Spotify asked for last.
+type ErrRateLimited struct {
+	RetryAfter time.Duration
+}
+
+func (e *ErrRateLimited) Error() string {
+	return fmt.Sprintf("spotify: rate limited, retry after %s", e.RetryAfter)
+}
+
+// APIError is an error response of the Web API or the accounts service. It
+// unwraps to ErrUnauthorized, ErrForbidden or ErrNotFound when the status
+// matches, so callers can use errors.Is.
+type APIError struct {
+	Status  int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("spotify: %d %s", e.Status, http.StatusText(e.Status))
+	}
+	return fmt.Sprintf("spotify: %d %s", e.Status, e.Message)
+}
+
+func (e *APIError) Unwrap() error {
+	switch e.Status {
+	case http.StatusUnauthorized:
+		return ErrUnauthorized
+	case http.StatusForbidden:
+		return ErrForbidden
+	case http.StatusNotFound:
+		return ErrNotFound
+	}
+	return nil
+}
+
+// decodeAPIError builds an APIError from a Web API error body:
+//
+//	{"error": {"status": 404, "message": "Resource not found"}}
+func decodeAPIError(status int, body []byte) *APIError {
+	var payload struct {
+		Error struct {
+			Status  int    `json:"status"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	_ = json.Unmarshal(body, &payload)
+
+	return &APIError{Status: status, Message: payload.Error.Message}
+}
+
+// decodeTokenError builds an APIError from an accounts service error body:
+//
+//	{"error": "invalid_grant", "error_description": "Refresh token revoked"}
+//
+// A rejected grant means the code or refresh token is no longer valid, which
+// is reported as unauthorized.
+func decodeTokenError(status int, body []byte) *APIError {
+	var payload struct {
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	_ = json.Unmarshal(body, &payload)
+
+	message := payload.ErrorDescription
+	if message == "" {
+		message = payload.Error
+	}
+
+	if payload.Error == "invalid_grant" {
+		status = http.StatusUnauthorized
+	}
+
+	return &APIError{Status: status, Message: message}
+}
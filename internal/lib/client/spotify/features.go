@@ -0,0 +1,37 @@
+package spotify
+
+import (
+	userModel "SpotifySorter/models"
+	"encoding/json"
+	"strings"
+)
+
+// AudioFeatures returns the audio features of the tracks, fetching up to 100
+// per call. Tracks Spotify has no features for are left out.
+func (c *Client) AudioFeatures(trackIds []string) ([]userModel.AudioFeatures, error) {
+	var features []userModel.AudioFeatures
+
+	for start := 0; start < len(trackIds); start += itemsLimit {
+		end := min(start+itemsLimit, len(trackIds))
+
+		response, err := c.Get("audio-features?ids=" + strings.Join(trackIds[start:end], ","))
+		if err != nil {
+			return nil, err
+		}
+
+		var page struct {
+			AudioFeatures []*userModel.AudioFeatures `json:"audio_features"`
+		}
+		if err := json.Unmarshal(response, &page); err != nil {
+			return nil, err
+		}
+
+		for _, f := range page.AudioFeatures {
+			if f != nil {
+				features = append(features, *f)
+			}
+		}
+	}
+
+	return features, nil
+}
@@ -0,0 +1,25 @@
+package spotify
+
+import (
+	userModel "SpotifySorter/models"
+	"strconv"
+)
+
+const savedTracksLimit = 50
+
+// SavedTracks returns the user's liked songs, most recently liked first, as
+// playlist items so they can be filtered and sorted like one.
+func (c *Client) SavedTracks() ([]userModel.PlaylistItem, error) {
+	saved, err := All[userModel.SavedTrack](c, "me/tracks?limit="+strconv.Itoa(savedTracksLimit))
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]userModel.PlaylistItem, len(saved))
+	for i, track := range saved {
+		items[i].AddedAt = track.AddedAt
+		items[i].Track = track.Track
+	}
+
+	return items, nil
+}
@@ -0,0 +1,52 @@
+package spotify
+
+import (
+	userModel "SpotifySorter/models"
+	"encoding/json"
+	"iter"
+)
+
+// Pages iterates over a paged Web API collection starting at endpoint,
+// following the "next" link of every page until the last one. Iteration
+// stops after the first error.
+func Pages[T any](client *Client, endpoint string) iter.Seq2[*userModel.Page[T], error] {
+	return func(yield func(*userModel.Page[T], error) bool) {
+		next := endpoint
+		for next != "" {
+			response, err := client.Get(next)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+
+			var page userModel.Page[T]
+			if err := json.Unmarshal(response, &page); err != nil {
+				yield(nil, err)
+				return
+			}
+
+			if !yield(&page, nil) {
+				return
+			}
+
+			if len(page.Items) == 0 {
+				return
+			}
+			next = page.Next
+		}
+	}
+}
+
+// All collects every item of a paged Web API collection.
+func All[T any](client *Client, endpoint string) ([]T, error) {
+	var items []T
+
+	for page, err := range Pages[T](client, endpoint) {
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, page.Items...)
+	}
+
+	return items, nil
+}
@@ -0,0 +1,238 @@
+package spotify
+
+import (
+	userModel "SpotifySorter/models"
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+const (
+	playlistsLimit = 50
+	// itemsLimit is both the page size of playlist items and the maximum
+	// number of items a single write call accepts.
+	itemsLimit = 100
+	// itemsReads is how often PlaylistItemsAt reads a playlist that keeps
+	// changing before it gives up.
+	itemsReads = 3
+)
+
+// UserPlaylists returns every playlist owned or followed by the user.
+func (c *Client) UserPlaylists(userId string) ([]userModel.Playlist, error) {
+	return All[userModel.Playlist](c, "users/"+userId+"/playlists?limit="+strconv.Itoa(playlistsLimit))
+}
+
+// PlaylistItems returns every item of the playlist in playlist order.
+func (c *Client) PlaylistItems(playlistId string) ([]userModel.PlaylistItem, error) {
+	return All[userModel.PlaylistItem](c, "playlists/"+playlistId+"/tracks?limit="+strconv.Itoa(itemsLimit))
+}
+
+// PlaylistItemsAt returns every item of the playlist together with the
+// snapshot id of the version they were read from. Items are read page by
+// page, so the snapshot id is read before and after them, and the items are
+// read again if the playlist changed in between.
+func (c *Client) PlaylistItemsAt(playlistId string) ([]userModel.PlaylistItem, string, error) {
+	for range itemsReads {
+		before, err := c.PlaylistSnapshotId(playlistId)
+		if err != nil {
+			return nil, "", err
+		}
+
+		items, err := c.PlaylistItems(playlistId)
+		if err != nil {
+			return nil, "", err
+		}
+
+		after, err := c.PlaylistSnapshotId(playlistId)
+		if err != nil {
+			return nil, "", err
+		}
+
+		if before == after {
+			return items, after, nil
+		}
+	}
+
+	return nil, "", ErrPlaylistChanged
+}
+
+// Playlist returns the playlist's details. Its items are left out; use
+// PlaylistItems for those.
+func (c *Client) Playlist(playlistId string) (*userModel.Playlist, error) {
+	response, err := c.Get("playlists/" + playlistId)
+	if err != nil {
+		return nil, err
+	}
+
+	var playlist userModel.Playlist
+	if err := json.Unmarshal(response, &playlist); err != nil {
+		return nil, err
+	}
+
+	return &playlist, nil
+}
+
+// PlaylistSnapshotId returns the id of the current version of the playlist.
+func (c *Client) PlaylistSnapshotId(playlistId string) (string, error) {
+	response, err := c.Get("playlists/" + playlistId + "?fields=snapshot_id")
+	if err != nil {
+		return "", err
+	}
+
+	return decodeSnapshotId(response)
+}
+
+// ReorderItems moves rangeLength items starting at rangeStart in front of the
+// item at insertBefore. An empty snapshotId applies the move to the latest
+// version of the playlist. It returns the new snapshot id.
+//
+// A move is not idempotent, although it is a PUT: if Spotify applied it
+// before failing, sending it again would move other items. Server errors are
+// therefore returned to the caller, which can re-read the playlist.
+func (c *Client) ReorderItems(playlistId string, rangeStart, insertBefore, rangeLength int, snapshotId string) (string, error) {
+	type Request struct {
+		RangeStart   int    `json:"range_start"`
+		InsertBefore int    `json:"insert_before"`
+		RangeLength  int    `json:"range_length"`
+		SnapshotId   string `json:"snapshot_id,omitempty"`
+	}
+
+	response, err := c.send(http.MethodPut, "playlists/"+playlistId+"/tracks", Request{
+		RangeStart:   rangeStart,
+		InsertBefore: insertBefore,
+		RangeLength:  rangeLength,
+		SnapshotId:   snapshotId,
+	}, false)
+	if err != nil {
+		return "", err
+	}
+
+	return decodeSnapshotId(response)
+}
+
+// AddItems inserts uris into the playlist at position, 100 per call, or
+// appends them to the end if position is negative. It returns the final
+// snapshot id.
+func (c *Client) AddItems(playlistId string, uris []string, position int) (string, error) {
+	type Request struct {
+		Uris     []string `json:"uris"`
+		Position *int     `json:"position,omitempty"`
+	}
+
+	var snapshotId string
+	for start := 0; start < len(uris); start += itemsLimit {
+		end := min(start+itemsLimit, len(uris))
+
+		req := Request{Uris: uris[start:end]}
+		if position >= 0 {
+			at := position + start
+			req.Position = &at
+		}
+
+		response, err := c.Send(http.MethodPost, "playlists/"+playlistId+"/tracks", req)
+		if err != nil {
+			return "", err
+		}
+
+		if snapshotId, err = decodeSnapshotId(response); err != nil {
+			return "", err
+		}
+	}
+
+	return snapshotId, nil
+}
+
+// RemoveItems removes every occurrence of uris from the playlist, 100 per
+// call. It returns the final snapshot id.
+func (c *Client) RemoveItems(playlistId string, uris []string, snapshotId string) (string, error) {
+	type Track struct {
+		Uri string `json:"uri"`
+	}
+	type Request struct {
+		Tracks     []Track `json:"tracks"`
+		SnapshotId string  `json:"snapshot_id,omitempty"`
+	}
+
+	for start := 0; start < len(uris); start += itemsLimit {
+		end := min(start+itemsLimit, len(uris))
+
+		tracks := make([]Track, 0, end-start)
+		for _, uri := range uris[start:end] {
+			tracks = append(tracks, Track{Uri: uri})
+		}
+
+		response, err := c.Send(http.MethodDelete, "playlists/"+playlistId+"/tracks", Request{
+			Tracks:     tracks,
+			SnapshotId: snapshotId,
+		})
+		if err != nil {
+			return "", err
+		}
+
+		if snapshotId, err = decodeSnapshotId(response); err != nil {
+			return "", err
+		}
+	}
+
+	return snapshotId, nil
+}
+
+// ReplaceItems sets the playlist contents to uris. The first 100 URIs replace
+// the playlist and the rest are appended. It returns the final snapshot id.
+func (c *Client) ReplaceItems(playlistId string, uris []string) (string, error) {
+	type Request struct {
+		Uris []string `json:"uris"`
+	}
+
+	// Replacing with an empty list clears the playlist; nil would be sent as null.
+	first := append([]string{}, uris[:min(itemsLimit, len(uris))]...)
+
+	response, err := c.Send(http.MethodPut, "playlists/"+playlistId+"/tracks", Request{Uris: first})
+	if err != nil {
+		return "", err
+	}
+
+	snapshotId, err := decodeSnapshotId(response)
+	if err != nil {
+		return "", err
+	}
+
+	if len(uris) <= itemsLimit {
+		return snapshotId, nil
+	}
+
+	return c.AddItems(playlistId, uris[itemsLimit:], -1)
+}
+
+// CreatePlaylist creates a new playlist owned by the user.
+func (c *Client) CreatePlaylist(userId string, details userModel.PlaylistDetails) (*userModel.Playlist, error) {
+	response, err := c.Send(http.MethodPost, "users/"+userId+"/playlists", details)
+	if err != nil {
+		return nil, err
+	}
+
+	var playlist userModel.Playlist
+	if err := json.Unmarshal(response, &playlist); err != nil {
+		return nil, err
+	}
+
+	return &playlist, nil
+}
+
+// UpdatePlaylistDetails changes the name, visibility or description of the
+// playlist.
+func (c *Client) UpdatePlaylistDetails(playlistId string, details userModel.PlaylistDetails) error {
+	_, err := c.Send(http.MethodPut, "playlists/"+playlistId, details)
+	return err
+}
+
+func decodeSnapshotId(response []byte) (string, error) {
+	var playlist struct {
+		SnapshotId string `json:"snapshot_id"`
+	}
+	if err := json.Unmarshal(response, &playlist); err != nil {
+		return "", err
+	}
+
+	return playlist.SnapshotId, nil
+}
@@ -0,0 +1,95 @@
+package spotify
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// Spotify enforces its limit per application over a rolling window, so
+	// the global limiter keeps the whole backend under it while the per-user
+	// limiter stops one user's bulk job from starving everybody else.
+	globalRate  = 20
+	globalBurst = 40
+	userRate    = 10
+	userBurst   = 20
+)
+
+// limiter is a token bucket. Callers that find it empty borrow a token from
+// the future and sleep until it would have been added.
+type limiter struct {
+	mu          sync.Mutex
+	rate        float64
+	burst       float64
+	tokens      float64
+	last        time.Time
+	pausedUntil time.Time
+}
+
+func newLimiter(rate float64, burst int) *limiter {
+	return &limiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// userLimiter returns the limiter shared by all clients of the user.
+func (a *API) userLimiter(userId int64) *limiter {
+	l, _ := a.userLimiters.LoadOrStore(userId, newLimiter(a.userRate, a.userBurst))
+	return l.(*limiter)
+}
+
+// SetRateLimits replaces the default request rates, in requests per second.
+// It must be called before the API is used.
+func (a *API) SetRateLimits(globalRate float64, globalBurst int, userRate float64, userBurst int) {
+	a.globalLimiter = newLimiter(globalRate, globalBurst)
+	a.userRate = userRate
+	a.userBurst = userBurst
+}
+
+// Wait blocks until the caller may send a request. If ctx is done first, the
+// borrowed token is returned and ctx's error is returned.
+func (l *limiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens--
+
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	if paused := l.pausedUntil.Sub(now); paused > wait {
+		wait = paused
+	}
+
+	l.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+
+	if err := sleep(ctx, wait); err != nil {
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return err
+	}
+
+	return nil
+}
+
+// pause makes every Wait block for at least d from now.
+func (l *limiter) pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if until := time.Now().Add(d); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
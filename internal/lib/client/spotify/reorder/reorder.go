@@ -0,0 +1,153 @@
+package reorder
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Move mirrors the body of Spotify's "update playlist items" reorder call:
+// RangeLength items starting at RangeStart are moved in front of the item at
+// InsertBefore. Both positions refer to the playlist as it was before the move.
+type Move struct {
+	RangeStart   int `json:"range_start"`
+	InsertBefore int `json:"insert_before"`
+	RangeLength  int `json:"range_length"`
+}
+
+// ReorderFunc performs a single move against the playlist version identified
+// by snapshotId and returns the snapshot id of the resulting version.
+type ReorderFunc func(move Move, snapshotId string) (string, error)
+
+// Plan computes a short sequence of moves that turns the current playlist into
+// the target one. order lists current positions in their target order, i.e.
+// order[i] is the current position of the item that must end up at i.
+//
+// Items on a longest increasing subsequence of the current order never move;
+// every other item is moved once, together with any following items that
+// already sit right behind it in the target order.
+func Plan(order []int) ([]Move, error) {
+	n := len(order)
+
+	// cur[p] is the target position of the item currently at position p.
+	cur := make([]int, n)
+	seen := make([]bool, n)
+	for target, pos := range order {
+		if pos < 0 || pos >= n || seen[pos] {
+			return nil, fmt.Errorf("order is not a permutation: position %d", pos)
+		}
+		seen[pos] = true
+		cur[pos] = target
+	}
+
+	placed := make([]bool, n)
+	for _, target := range longestIncreasing(cur) {
+		placed[target] = true
+	}
+
+	var moves []Move
+	for target := 0; target < n; target++ {
+		if placed[target] {
+			continue
+		}
+
+		start := indexOf(cur, target)
+		length := 1
+		for start+length < n && cur[start+length] == target+length && !placed[target+length] {
+			length++
+		}
+
+		// Every target below this one is already placed and in order, so the
+		// block belongs right after its predecessor.
+		insertBefore := 0
+		if target > 0 {
+			insertBefore = indexOf(cur, target-1) + 1
+		}
+
+		if insertBefore < start || insertBefore > start+length {
+			move := Move{RangeStart: start, InsertBefore: insertBefore, RangeLength: length}
+			cur = Apply(cur, move)
+			moves = append(moves, move)
+		}
+
+		for i := 0; i < length; i++ {
+			placed[target+i] = true
+		}
+	}
+
+	return moves, nil
+}
+
+// Apply returns list with move applied, using Spotify's semantics.
+func Apply[T any](list []T, move Move) []T {
+	end := move.RangeStart + move.RangeLength
+
+	block := append([]T(nil), list[move.RangeStart:end]...)
+	rest := append(append([]T(nil), list[:move.RangeStart]...), list[end:]...)
+
+	at := move.InsertBefore
+	if at > move.RangeStart {
+		at -= move.RangeLength
+	}
+
+	result := make([]T, 0, len(list))
+	result = append(result, rest[:at]...)
+	result = append(result, block...)
+	return append(result, rest[at:]...)
+}
+
+// Execute performs moves in order, passing every call the snapshot id returned
+// by the previous one. It returns the last snapshot id and the number of moves
+// that were applied before an error, if any.
+func Execute(moves []Move, snapshotId string, reorder ReorderFunc) (string, int, error) {
+	for i, move := range moves {
+		next, err := reorder(move, snapshotId)
+		if err != nil {
+			return snapshotId, i, fmt.Errorf("move %d of %d: %w", i+1, len(moves), err)
+		}
+		snapshotId = next
+	}
+
+	return snapshotId, len(moves), nil
+}
+
+// longestIncreasing returns the values of a longest strictly increasing
+// subsequence of seq.
+func longestIncreasing(seq []int) []int {
+	// tails[k] is the index in seq of the smallest tail of an increasing
+	// subsequence of length k+1.
+	var tails []int
+	prev := make([]int, len(seq))
+
+	for i, v := range seq {
+		k := sort.Search(len(tails), func(j int) bool { return seq[tails[j]] >= v })
+		if k > 0 {
+			prev[i] = tails[k-1]
+		} else {
+			prev[i] = -1
+		}
+		if k == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[k] = i
+		}
+	}
+
+	result := make([]int, len(tails))
+	if len(tails) == 0 {
+		return result
+	}
+	for i, k := tails[len(tails)-1], len(tails)-1; k >= 0; i, k = prev[i], k-1 {
+		result[k] = seq[i]
+	}
+
+	return result
+}
+
+func indexOf(list []int, value int) int {
+	for i, v := range list {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,187 @@
+package reorder
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+func TestPlan(t *testing.T) {
+	tests := []struct {
+		name  string
+		order []int
+		moves int
+	}{
+		{name: "empty", order: []int{}, moves: 0},
+		{name: "identity", order: []int{0, 1, 2, 3}, moves: 0},
+		{name: "swap", order: []int{1, 0}, moves: 1},
+		{name: "first to last", order: []int{1, 2, 3, 0}, moves: 1},
+		{name: "last to first", order: []int{3, 0, 1, 2}, moves: 1},
+		{name: "reverse", order: []int{3, 2, 1, 0}, moves: 3},
+		// The two items that are out of place are adjacent in both orders,
+		// so they move together.
+		{name: "swap halves", order: []int{2, 3, 0, 1}, moves: 1},
+		{name: "interleave", order: []int{0, 2, 4, 1, 3, 5}, moves: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			moves, err := Plan(tt.order)
+			if err != nil {
+				t.Fatalf("Plan(%v): %v", tt.order, err)
+			}
+
+			if got := applyAll(len(tt.order), moves); !slices.Equal(got, tt.order) {
+				t.Errorf("applying %v gives %v, want %v", moves, got, tt.order)
+			}
+			if len(moves) != tt.moves {
+				t.Errorf("Plan(%v) returned %d moves, want %d", tt.order, len(moves), tt.moves)
+			}
+		})
+	}
+}
+
+func TestPlanInvalidOrder(t *testing.T) {
+	for _, order := range [][]int{{0, 0}, {0, 2}, {-1}, {1}} {
+		if _, err := Plan(order); err == nil {
+			t.Errorf("Plan(%v) succeeded, want an error", order)
+		}
+	}
+}
+
+// TestPlanRandom checks random permutations: the moves must reach the target
+// order, and every item off a longest increasing subsequence moves at most
+// once. Adjacent items can share a move, so there may be fewer moves.
+func TestPlanRandom(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+
+	for i := 0; i < 500; i++ {
+		n := rng.IntN(60)
+		order := rng.Perm(n)
+
+		// Nearly sorted playlists are the common case, so half of the
+		// permutations only displace a few items.
+		if i%2 == 0 {
+			order = make([]int, n)
+			for j := range order {
+				order[j] = j
+			}
+			for k := rng.IntN(4); k > 0 && n > 1; k-- {
+				from, to := rng.IntN(n), rng.IntN(n)
+				item := order[from]
+				order = slices.Insert(slices.Delete(order, from, from+1), to, item)
+			}
+		}
+
+		moves, err := Plan(order)
+		if err != nil {
+			t.Fatalf("Plan(%v): %v", order, err)
+		}
+
+		if got := applyAll(n, moves); !slices.Equal(got, order) {
+			t.Fatalf("applying Plan(%v) gives %v", order, got)
+		}
+
+		if limit := n - lisLength(order); len(moves) > limit {
+			t.Fatalf("Plan(%v) returned %d moves, want at most n - LIS = %d", order, len(moves), limit)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		move Move
+		want []string
+	}{
+		{Move{RangeStart: 0, InsertBefore: 3, RangeLength: 1}, []string{"b", "c", "a", "d"}},
+		{Move{RangeStart: 3, InsertBefore: 0, RangeLength: 1}, []string{"d", "a", "b", "c"}},
+		{Move{RangeStart: 0, InsertBefore: 4, RangeLength: 2}, []string{"c", "d", "a", "b"}},
+		{Move{RangeStart: 1, InsertBefore: 1, RangeLength: 2}, []string{"a", "b", "c", "d"}},
+	}
+
+	for _, tt := range tests {
+		list := []string{"a", "b", "c", "d"}
+		if got := Apply(list, tt.move); !slices.Equal(got, tt.want) {
+			t.Errorf("Apply(%v, %+v) = %v, want %v", list, tt.move, got, tt.want)
+		}
+	}
+}
+
+func TestExecuteChainsSnapshots(t *testing.T) {
+	moves := []Move{{0, 2, 1}, {1, 0, 1}, {2, 0, 1}}
+
+	calls := 0
+	snapshotId, applied, err := Execute(moves, "s0", func(move Move, snapshotId string) (string, error) {
+		if want := fmt.Sprintf("s%d", calls); snapshotId != want {
+			t.Errorf("move %d got snapshot %q, want %q", calls+1, snapshotId, want)
+		}
+		if move != moves[calls] {
+			t.Errorf("move %d is %+v, want %+v", calls+1, move, moves[calls])
+		}
+		calls++
+		return fmt.Sprintf("s%d", calls), nil
+	})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+
+	if snapshotId != "s3" || applied != 3 {
+		t.Errorf("Execute = %q, %d, want %q, 3", snapshotId, applied, "s3")
+	}
+}
+
+func TestExecuteStopsOnError(t *testing.T) {
+	moves := []Move{{0, 2, 1}, {1, 0, 1}, {2, 0, 1}}
+	errFailed := errors.New("failed")
+
+	calls := 0
+	snapshotId, applied, err := Execute(moves, "s0", func(move Move, snapshotId string) (string, error) {
+		calls++
+		if calls == 2 {
+			return "", errFailed
+		}
+		return fmt.Sprintf("s%d", calls), nil
+	})
+
+	if !errors.Is(err, errFailed) {
+		t.Fatalf("Execute returned %v, want %v", err, errFailed)
+	}
+	if calls != 2 {
+		t.Errorf("Execute made %d calls, want it to stop after the failing second", calls)
+	}
+	if snapshotId != "s1" || applied != 1 {
+		t.Errorf("Execute = %q, %d, want the state after the first move: %q, 1", snapshotId, applied, "s1")
+	}
+}
+
+// applyAll applies moves to the positions 0 to n-1 and returns the result,
+// which lists the original position of every item in its new order.
+func applyAll(n int, moves []Move) []int {
+	list := make([]int, n)
+	for i := range list {
+		list[i] = i
+	}
+	for _, move := range moves {
+		list = Apply(list, move)
+	}
+	return list
+}
+
+// lisLength returns the length of a longest increasing subsequence of seq,
+// computed independently of longestIncreasing.
+func lisLength(seq []int) int {
+	best := 0
+	length := make([]int, len(seq))
+	for i := range seq {
+		length[i] = 1
+		for j := 0; j < i; j++ {
+			if seq[j] < seq[i] && length[j]+1 > length[i] {
+				length[i] = length[j] + 1
+			}
+		}
+		best = max(best, length[i])
+	}
+	return best
+}
@@ -2,46 +2,216 @@ package spotify
 
 import (
 	sl "SpotifySorter/internal/lib/logger/slog"
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"io"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
-func GetRequest(log *slog.Logger, accessToken, endpoint string) ([]byte, error) {
-	reqToSpotify, err := http.NewRequest("GET", "https://api.spotify.com/v1/"+endpoint, nil)
+const (
+	DefaultAPIURL      = "https://api.spotify.com/v1/"
+	DefaultAccountsURL = "https://accounts.spotify.com/"
+)
+
+const (
+	// maxAttempts is how many times a request is sent before a 429 or 5xx
+	// response is returned as an error.
+	maxAttempts = 5
+	// maxRetryAfter caps how long a rate limited request waits for Spotify;
+	// longer Retry-After values fail the request instead.
+	maxRetryAfter = time.Minute
+	// retryBackoff is the first delay between attempts after a 5xx response or
+	// a 429 without a Retry-After header. It doubles with every attempt.
+	retryBackoff = 500 * time.Millisecond
+)
+
+// API holds the endpoints and HTTP client used to reach Spotify, together
+// with the rate limiters shared by every Client created from it.
+type API struct {
+	apiURL      string
+	accountsURL string
+	httpClient  *http.Client
+
+	globalLimiter *limiter
+	userLimiters  sync.Map
+	userRate      float64
+	userBurst     int
+}
+
+// New returns an API talking to the Web API at apiURL and the accounts
+// service at accountsURL. A nil httpClient means http.DefaultClient.
+func New(apiURL, accountsURL string, httpClient *http.Client) *API {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &API{
+		apiURL:        withTrailingSlash(apiURL),
+		accountsURL:   withTrailingSlash(accountsURL),
+		httpClient:    httpClient,
+		globalLimiter: newLimiter(globalRate, globalBurst),
+		userRate:      userRate,
+		userBurst:     userBurst,
+	}
+}
+
+func (a *API) GetRequest(ctx context.Context, log *slog.Logger, accessToken, endpoint string) ([]byte, error) {
+	return a.SendRequest(ctx, log, http.MethodGet, accessToken, endpoint, nil)
+}
+
+// SendRequest sends a request to the Spotify Web API. A non-nil payload is
+// encoded as the JSON request body. Rate limited (429) responses are retried,
+// waiting as long as Spotify's Retry-After header asks. Server errors are only
+// retried for idempotent methods: Spotify may have applied a POST before
+// failing, and sending it again would e.g. add the same tracks twice.
+func (a *API) SendRequest(ctx context.Context, log *slog.Logger, method, accessToken, endpoint string, payload any) ([]byte, error) {
+	return a.send(ctx, log, method, accessToken, endpoint, payload, idempotent(method))
+}
+
+// send is SendRequest for requests whose idempotency the method alone does
+// not tell. Server errors are retried only if retry is set.
+func (a *API) send(ctx context.Context, log *slog.Logger, method, accessToken, endpoint string, payload any, retry bool) ([]byte, error) {
+	var data []byte
+	if payload != nil {
+		var err error
+		data, err = json.Marshal(payload)
+		if err != nil {
+			log.Error("failed to encode request body", sl.Err(err))
+			return nil, errors.New("failed to encode request body")
+		}
+	}
+
+	url := a.endpointURL(endpoint)
+
+	for attempt := 1; ; attempt++ {
+		status, header, respBody, err := a.doRequest(ctx, log, method, accessToken, url, data)
+		if err != nil {
+			return nil, err
+		}
+
+		backoff := retryBackoff << (attempt - 1)
+
+		switch {
+		case status == http.StatusTooManyRequests:
+			wait := retryAfter(header, backoff)
+			if attempt == maxAttempts || wait > maxRetryAfter {
+				log.Error("rate limited", slog.String("url", url), slog.Duration("retry_after", wait))
+				return nil, &ErrRateLimited{RetryAfter: wait}
+			}
+
+			log.Warn("rate limited, retrying", slog.String("url", url), slog.Duration("retry_after", wait))
+			// Spotify limits the whole application, so every request waits.
+			a.globalLimiter.pause(wait)
+			if err := a.globalLimiter.Wait(ctx); err != nil {
+				return nil, err
+			}
+			continue
+
+		case status >= 500 && attempt < maxAttempts && retry:
+			log.Warn("server error, retrying", slog.String("url", url), slog.Int("status", status), slog.Duration("backoff", backoff))
+			if err := sleep(ctx, backoff); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if status < 200 || status >= 300 {
+			apiErr := decodeAPIError(status, respBody)
+			log.Error("request failed", slog.String("url", url), slog.Int("status", status), slog.String("message", apiErr.Message))
+			return nil, apiErr
+		}
+
+		return respBody, nil
+	}
+}
+
+// doRequest sends a single request and reads the whole response.
+func (a *API) doRequest(ctx context.Context, log *slog.Logger, method, accessToken, url string, data []byte) (int, http.Header, []byte, error) {
+	var body io.Reader
+	if data != nil {
+		body = bytes.NewReader(data)
+	}
+
+	reqToSpotify, err := http.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
 		log.Error("failed to create request", sl.Err(err))
-		return nil, errors.New("failed to create request")
+		return 0, nil, nil, errors.New("failed to create request")
 	}
 
 	reqToSpotify.Header.Set("Authorization", "Bearer "+accessToken)
+	if data != nil {
+		reqToSpotify.Header.Set("Content-Type", "application/json")
+	}
 
-	client := &http.Client{}
-	resp, err := client.Do(reqToSpotify)
+	resp, err := a.httpClient.Do(reqToSpotify)
 	if err != nil {
-		log.Error("failed to send request", slog.String("url", "https://api.spotify.com/v1/"+endpoint), sl.Err(err))
-		return nil, errors.New("failed to send request to Spotify")
+		if ctx.Err() != nil {
+			return 0, nil, nil, ctx.Err()
+		}
+		log.Error("failed to send request", slog.String("url", url), sl.Err(err))
+		return 0, nil, nil, errors.New("failed to send request to Spotify")
 	}
 	defer resp.Body.Close()
 
-	log.Info("response received", slog.String("url", "https://api.spotify.com/v1/"+endpoint), slog.Int("status", resp.StatusCode))
+	log.Info("response received", slog.String("method", method), slog.String("url", url), slog.Int("status", resp.StatusCode))
 
-	if resp.StatusCode == http.StatusForbidden {
-		log.Error("unauthorized")
-		return nil, errors.New("unauthorized")
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Error("failed to read response body", sl.Err(err))
+		return 0, nil, nil, errors.New("failed to read response body")
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		log.Error("bad request", slog.Any("body", resp.Body))
-		return nil, errors.New("bad request")
+	return resp.StatusCode, resp.Header, respBody, nil
+}
+
+// sleep pauses for d, or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
+}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Error("failed to read response body", sl.Err(err))
-		return nil, errors.New("failed to read response body")
+// idempotent reports whether sending a request with method twice has the
+// same effect as sending it once. Not every PUT is: see Client.ReorderItems.
+func idempotent(method string) bool {
+	return method == http.MethodGet || method == http.MethodPut
+}
+
+// retryAfter returns the delay requested by the Retry-After header, which
+// Spotify sends in seconds, or fallback if it is missing.
+func retryAfter(header http.Header, fallback time.Duration) time.Duration {
+	seconds, err := strconv.Atoi(header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return fallback
 	}
+	return time.Duration(seconds) * time.Second
+}
 
-	return body, nil
+// endpointURL resolves endpoint against the Web API base URL. Absolute URLs,
+// such as the "next" links of paged responses, are used as is.
+func (a *API) endpointURL(endpoint string) string {
+	if strings.HasPrefix(endpoint, "https://") || strings.HasPrefix(endpoint, "http://") {
+		return endpoint
+	}
+	return a.apiURL + endpoint
+}
+
+func withTrailingSlash(url string) string {
+	if strings.HasSuffix(url, "/") {
+		return url
+	}
+	return url + "/"
 }
@@ -0,0 +1,576 @@
+package spotifytest
+
+import (
+	userModel "SpotifySorter/models"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type contextKey struct{}
+
+// authorize grants access as the user set with SetLoginUser and redirects
+// back to redirect_uri with an authorization code and the state.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	redirect, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || redirect.Scheme == "" {
+		writeTokenError(w, http.StatusBadRequest, "invalid_request", "Invalid redirect URI")
+		return
+	}
+
+	s.mu.Lock()
+	userId := s.loginUser
+	s.mu.Unlock()
+
+	if userId == "" {
+		writeTokenError(w, http.StatusBadRequest, "access_denied", "No login user set")
+		return
+	}
+
+	challenge := ""
+	if query.Get("code_challenge_method") == "S256" {
+		challenge = query.Get("code_challenge")
+	}
+
+	values := redirect.Query()
+	values.Set("code", s.AuthorizePKCE(userId, challenge))
+	values.Set("state", query.Get("state"))
+	redirect.RawQuery = values.Encode()
+
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// token implements the authorization_code and refresh_token grants.
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "Basic ") {
+		writeTokenError(w, http.StatusBadRequest, "invalid_client", "Invalid client")
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		writeTokenError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var userId string
+	var ok bool
+
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		code := r.PostForm.Get("code")
+		var auth authorization
+		auth, ok = s.codes[code]
+		delete(s.codes, code)
+		userId = auth.userId
+
+		if ok && auth.challenge != "" && !verifies(r.PostForm.Get("code_verifier"), auth.challenge) {
+			writeTokenError(w, http.StatusBadRequest, "invalid_grant", "code_verifier was incorrect")
+			return
+		}
+	case "refresh_token":
+		userId, ok = s.refreshTokens[r.PostForm.Get("refresh_token")]
+	default:
+		writeTokenError(w, http.StatusBadRequest, "unsupported_grant_type", "Unsupported grant type")
+		return
+	}
+
+	if !ok {
+		writeTokenError(w, http.StatusBadRequest, "invalid_grant", "Invalid authorization code or refresh token")
+		return
+	}
+
+	accessToken, refreshToken := s.issueTokens(userId)
+
+	// Like Spotify, a refresh keeps the existing refresh token.
+	if r.PostForm.Get("grant_type") == "refresh_token" {
+		delete(s.refreshTokens, refreshToken)
+		refreshToken = ""
+	}
+
+	writeJSON(w, http.StatusOK, userModel.AccessTokensByCode{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		Scope:        "playlist-read-private playlist-modify-private playlist-modify-public",
+		ExpiresIn:    3600,
+		RefreshToken: refreshToken,
+	})
+}
+
+// verifies reports whether verifier is the PKCE verifier of the S256
+// challenge.
+func verifies(verifier, challenge string) bool {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:]) == challenge
+}
+
+func (s *Server) record(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, Request{Method: r.Method, Path: apiPath(r)})
+		s.mu.Unlock()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) fault(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		var matched *Fault
+		for i, fault := range s.faults {
+			if (fault.Method == "" || fault.Method == r.Method) && strings.HasPrefix(apiPath(r), fault.Path) {
+				matched = fault
+				if fault.Count--; fault.Count == 0 {
+					s.faults = append(s.faults[:i], s.faults[i+1:]...)
+				}
+				break
+			}
+		}
+		s.mu.Unlock()
+
+		if matched == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if matched.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(matched.RetryAfter.Seconds())))
+		}
+		writeError(w, matched.Status, http.StatusText(matched.Status))
+	})
+}
+
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accessToken, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+		s.mu.Lock()
+		userId, ok := s.accessTokens[accessToken]
+		s.mu.Unlock()
+
+		if !found || !ok {
+			writeError(w, http.StatusUnauthorized, "The access token expired")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, userId)))
+	})
+}
+
+func (s *Server) me(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	user, ok := s.users[currentUser(r)]
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"id":           user.Id,
+		"display_name": user.DisplayName,
+		"email":        user.Email,
+		"country":      user.Country,
+		"product":      user.Product,
+		"type":         "user",
+		"uri":          "spotify:user:" + user.Id,
+	})
+}
+
+func (s *Server) getSavedTracks(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	writePage(w, r, s.savedTracks[currentUser(r)], 20, 50)
+}
+
+func (s *Server) getAudioFeatures(w http.ResponseWriter, r *http.Request) {
+	ids := strings.Split(r.URL.Query().Get("ids"), ",")
+	if len(ids) > 100 {
+		writeError(w, http.StatusBadRequest, "Too many ids requested")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	features := make([]*userModel.AudioFeatures, len(ids))
+	for i, id := range ids {
+		if f, ok := s.features[id]; ok {
+			features[i] = &f
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"audio_features": features})
+}
+
+func (s *Server) getUserPlaylists(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var playlists []userModel.Playlist
+	for _, id := range s.userPlaylists[chi.URLParam(r, "user")] {
+		playlists = append(playlists, s.playlists[id].view())
+	}
+
+	writePage(w, r, playlists, 20, 50)
+}
+
+func (s *Server) postUserPlaylist(w http.ResponseWriter, r *http.Request) {
+	userId := chi.URLParam(r, "user")
+	if userId != currentUser(r) {
+		writeError(w, http.StatusForbidden, "You cannot create a playlist for another user")
+		return
+	}
+
+	var details userModel.PlaylistDetails
+	if err := json.NewDecoder(r.Body).Decode(&details); err != nil || details.Name == "" {
+		writeError(w, http.StatusBadRequest, "Missing required field: name")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	writeJSON(w, http.StatusCreated, s.createPlaylist(userId, details).view())
+}
+
+func (s *Server) getPlaylist(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.playlists[chi.URLParam(r, "id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Resource not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, p.view())
+}
+
+func (s *Server) putPlaylist(w http.ResponseWriter, r *http.Request) {
+	var details userModel.PlaylistDetails
+	if err := json.NewDecoder(r.Body).Decode(&details); err != nil {
+		writeError(w, http.StatusBadRequest, "Error parsing JSON")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.ownPlaylist(w, r)
+	if !ok {
+		return
+	}
+
+	if details.Name != "" {
+		p.Name = details.Name
+	}
+	if details.Description != "" {
+		p.Description = details.Description
+	}
+	if details.Public != nil {
+		p.Public = *details.Public
+	}
+	if details.Collaborative != nil {
+		p.Collaborative = *details.Collaborative
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) getPlaylistTracks(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.playlists[chi.URLParam(r, "id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Resource not found")
+		return
+	}
+
+	writePage(w, r, p.items, 100, 100)
+}
+
+// putPlaylistTracks either replaces the playlist with the given uris or
+// reorders a range of items, depending on the body.
+func (s *Server) putPlaylistTracks(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Uris         *[]string `json:"uris"`
+		RangeStart   *int      `json:"range_start"`
+		InsertBefore *int      `json:"insert_before"`
+		RangeLength  *int      `json:"range_length"`
+		SnapshotId   string    `json:"snapshot_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Error parsing JSON")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.ownPlaylist(w, r)
+	if !ok {
+		return
+	}
+
+	if req.Uris != nil {
+		items, ok := s.itemsFor(w, currentUser(r), *req.Uris)
+		if !ok {
+			return
+		}
+		p.items = items
+		p.changed()
+		writeJSON(w, http.StatusOK, map[string]string{"snapshot_id": p.SnapshotId})
+		return
+	}
+
+	if req.RangeStart == nil || req.InsertBefore == nil {
+		writeError(w, http.StatusBadRequest, "Missing range_start or insert_before")
+		return
+	}
+
+	if !checkSnapshot(w, p, req.SnapshotId) {
+		return
+	}
+
+	start, before, length := *req.RangeStart, *req.InsertBefore, 1
+	if req.RangeLength != nil {
+		length = *req.RangeLength
+	}
+
+	n := len(p.items)
+	if start < 0 || length < 1 || start+length > n || before < 0 || before > n {
+		writeError(w, http.StatusBadRequest, "Index out of bounds")
+		return
+	}
+
+	if before < start || before > start+length {
+		block := append([]userModel.PlaylistItem(nil), p.items[start:start+length]...)
+		rest := append(append([]userModel.PlaylistItem(nil), p.items[:start]...), p.items[start+length:]...)
+		if before > start {
+			before -= length
+		}
+		p.items = append(append(append([]userModel.PlaylistItem(nil), rest[:before]...), block...), rest[before:]...)
+	}
+
+	p.changed()
+	writeJSON(w, http.StatusOK, map[string]string{"snapshot_id": p.SnapshotId})
+}
+
+func (s *Server) postPlaylistTracks(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Uris     []string `json:"uris"`
+		Position *int     `json:"position"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Error parsing JSON")
+		return
+	}
+
+	if len(req.Uris) > 100 {
+		writeError(w, http.StatusBadRequest, "You can add a maximum of 100 tracks per request.")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.ownPlaylist(w, r)
+	if !ok {
+		return
+	}
+
+	items, ok := s.itemsFor(w, currentUser(r), req.Uris)
+	if !ok {
+		return
+	}
+
+	position := len(p.items)
+	if req.Position != nil {
+		position = *req.Position
+		if position < 0 || position > len(p.items) {
+			writeError(w, http.StatusBadRequest, "Index out of bounds")
+			return
+		}
+	}
+
+	p.items = append(append(append([]userModel.PlaylistItem(nil), p.items[:position]...), items...), p.items[position:]...)
+	p.changed()
+
+	writeJSON(w, http.StatusCreated, map[string]string{"snapshot_id": p.SnapshotId})
+}
+
+func (s *Server) deletePlaylistTracks(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Tracks []struct {
+			Uri string `json:"uri"`
+		} `json:"tracks"`
+		SnapshotId string `json:"snapshot_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Error parsing JSON")
+		return
+	}
+
+	if len(req.Tracks) > 100 {
+		writeError(w, http.StatusBadRequest, "You can remove a maximum of 100 tracks per request.")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.ownPlaylist(w, r)
+	if !ok {
+		return
+	}
+
+	if !checkSnapshot(w, p, req.SnapshotId) {
+		return
+	}
+
+	remove := map[string]bool{}
+	for _, track := range req.Tracks {
+		remove[track.Uri] = true
+	}
+
+	kept := p.items[:0:0]
+	for _, item := range p.items {
+		if !remove[item.Track.Uri] {
+			kept = append(kept, item)
+		}
+	}
+	p.items = kept
+	p.changed()
+
+	writeJSON(w, http.StatusOK, map[string]string{"snapshot_id": p.SnapshotId})
+}
+
+// ownPlaylist looks up the playlist of the request and checks that the
+// current user may modify it. It must be called with s.mu held.
+func (s *Server) ownPlaylist(w http.ResponseWriter, r *http.Request) (*playlist, bool) {
+	p, ok := s.playlists[chi.URLParam(r, "id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Resource not found")
+		return nil, false
+	}
+
+	if p.Owner.Id != currentUser(r) && !p.Collaborative {
+		writeError(w, http.StatusForbidden, "You cannot modify a playlist you do not own")
+		return nil, false
+	}
+
+	return p, true
+}
+
+// itemsFor builds playlist items for uris, which must all be known tracks.
+// It must be called with s.mu held.
+func (s *Server) itemsFor(w http.ResponseWriter, userId string, uris []string) ([]userModel.PlaylistItem, bool) {
+	items := make([]userModel.PlaylistItem, 0, len(uris))
+	for _, uri := range uris {
+		track, ok := s.tracks[uri]
+		if !ok {
+			writeError(w, http.StatusBadRequest, "Invalid track uri: "+uri)
+			return nil, false
+		}
+		items = append(items, s.newItem(userId, track))
+	}
+	return items, true
+}
+
+// checkSnapshot rejects a mutation made against a snapshot other than the
+// current one. Spotify would accept it; see Server.
+func checkSnapshot(w http.ResponseWriter, p *playlist, snapshotId string) bool {
+	if snapshotId != "" && snapshotId != p.SnapshotId {
+		writeError(w, http.StatusBadRequest, "Invalid snapshot id")
+		return false
+	}
+	return true
+}
+
+// writePage writes the page of items selected by the offset and limit query
+// parameters, with Web API style next and previous links.
+func writePage[T any](w http.ResponseWriter, r *http.Request, items []T, defaultLimit, maxLimit int) {
+	query := r.URL.Query()
+
+	offset, _ := strconv.Atoi(query.Get("offset"))
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil {
+		limit = defaultLimit
+	}
+	if offset < 0 || limit < 1 || limit > maxLimit {
+		writeError(w, http.StatusBadRequest, "Invalid limit or offset")
+		return
+	}
+
+	link := func(offset int) string {
+		return fmt.Sprintf("http://%s%s?offset=%d&limit=%d", r.Host, r.URL.Path, offset, limit)
+	}
+
+	start := min(offset, len(items))
+	end := min(offset+limit, len(items))
+
+	page := userModel.Page[T]{
+		Href:   link(offset),
+		Limit:  limit,
+		Offset: offset,
+		Total:  len(items),
+		Items:  append([]T{}, items[start:end]...),
+	}
+	if end < len(items) {
+		page.Next = link(end)
+	}
+	if offset > 0 {
+		page.Previous = link(max(offset-limit, 0))
+	}
+
+	writeJSON(w, http.StatusOK, page)
+}
+
+func currentUser(r *http.Request) string {
+	userId, _ := r.Context().Value(contextKey{}).(string)
+	return userId
+}
+
+// apiPath returns the request path relative to the API base URL.
+func apiPath(r *http.Request) string {
+	return strings.TrimPrefix(r.URL.Path, "/v1/")
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]any{
+		"error": map[string]any{
+			"status":  status,
+			"message": message,
+		},
+	})
+}
+
+func writeTokenError(w http.ResponseWriter, status int, code, description string) {
+	writeJSON(w, status, map[string]string{
+		"error":             code,
+		"error_description": description,
+	})
+}
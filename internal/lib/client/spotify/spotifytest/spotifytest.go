@@ -0,0 +1,402 @@
+// Package spotifytest provides an in-process fake of the Spotify accounts
+// service and the parts of the Web API the backend uses, for tests and for
+// running the backend offline.
+package spotifytest
+
+import (
+	"SpotifySorter/internal/lib/client/spotify"
+	userModel "SpotifySorter/models"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type User struct {
+	Id          string
+	DisplayName string
+	Email       string
+	Country     string
+	Product     string
+}
+
+// Fault makes the server answer matching requests with Status instead of
+// handling them. Path is a prefix of the request path without the API base,
+// e.g. "playlists/"; an empty Path matches every request. Count is how many
+// requests fail before the fault is used up.
+type Fault struct {
+	Method     string
+	Path       string
+	Status     int
+	RetryAfter time.Duration
+	Count      int
+}
+
+// Request is a request received by the server.
+type Request struct {
+	Method string
+	Path   string
+}
+
+// Server is a fake Spotify. Seed it with users, tracks and playlists, point a
+// spotify.API at it with API, and inspect the resulting playlists.
+//
+// Every playlist change produces a new snapshot id. Mutations that pass a
+// snapshot_id other than the current one are rejected, so callers must chain
+// the ids returned by previous calls. Spotify itself is more lenient: it
+// applies a change made against an older snapshot to that version and merges
+// the result with the changes made since. The fake is strict on purpose, as
+// a caller that loses track of the snapshot id usually also computed its
+// positions against the wrong version.
+type Server struct {
+	*httptest.Server
+
+	mu            sync.Mutex
+	users         map[string]*User
+	tracks        map[string]userModel.Track
+	features      map[string]userModel.AudioFeatures
+	playlists     map[string]*playlist
+	userPlaylists map[string][]string
+	savedTracks   map[string][]userModel.SavedTrack
+	codes         map[string]authorization
+	accessTokens  map[string]string
+	refreshTokens map[string]string
+	faults        []*Fault
+	requests      []Request
+	nextId        int
+	loginUser     string
+}
+
+// authorization is a pending authorization code. A code issued with a PKCE
+// challenge is only exchanged together with the matching verifier.
+type authorization struct {
+	userId    string
+	challenge string
+}
+
+type playlist struct {
+	userModel.Playlist
+	items   []userModel.PlaylistItem
+	version int
+}
+
+// NewServer starts a fake Spotify. Close it when done.
+func NewServer() *Server {
+	s := newServer()
+	s.Server = httptest.NewServer(s.routes())
+
+	return s
+}
+
+// Listen is like NewServer but listens on addr, so that a backend can be
+// configured to use it; see cmd/spotifytest.
+func Listen(addr string) (*Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := newServer()
+	s.Server = httptest.NewUnstartedServer(s.routes())
+	_ = s.Server.Listener.Close()
+	s.Server.Listener = listener
+	s.Server.Start()
+
+	return s, nil
+}
+
+func newServer() *Server {
+	return &Server{
+		users:         map[string]*User{},
+		tracks:        map[string]userModel.Track{},
+		features:      map[string]userModel.AudioFeatures{},
+		playlists:     map[string]*playlist{},
+		userPlaylists: map[string][]string{},
+		savedTracks:   map[string][]userModel.SavedTrack{},
+		codes:         map[string]authorization{},
+		accessTokens:  map[string]string{},
+		refreshTokens: map[string]string{},
+	}
+}
+
+// APIURL is the Web API base URL of the server.
+func (s *Server) APIURL() string {
+	return s.URL + "/v1/"
+}
+
+// AccountsURL is the accounts service base URL of the server.
+func (s *Server) AccountsURL() string {
+	return s.URL + "/"
+}
+
+// API returns a spotify.API talking to the server. Its rate limits are high
+// enough not to slow tests down; use InjectFault to exercise 429 handling.
+func (s *Server) API() *spotify.API {
+	api := spotify.New(s.APIURL(), s.AccountsURL(), s.Client())
+	api.SetRateLimits(1000, 1000, 1000, 1000)
+	return api
+}
+
+func (s *Server) AddUser(user User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users[user.Id] = &user
+}
+
+// AddTracks makes tracks known to the server, so they can be added to
+// playlists. Missing ids and URIs are generated.
+func (s *Server) AddTracks(tracks ...userModel.Track) []userModel.Track {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range tracks {
+		if tracks[i].Id == "" {
+			tracks[i].Id = s.newId("track")
+		}
+		if tracks[i].Uri == "" {
+			tracks[i].Uri = "spotify:track:" + tracks[i].Id
+		}
+		tracks[i].Type = "track"
+		s.tracks[tracks[i].Uri] = tracks[i]
+	}
+
+	return tracks
+}
+
+// AddAudioFeatures sets the audio features returned for tracks, keyed by the
+// Id of each entry.
+func (s *Server) AddAudioFeatures(features ...userModel.AudioFeatures) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, f := range features {
+		s.features[f.Id] = f
+	}
+}
+
+// AddPlaylist creates a playlist owned by ownerId holding the tracks with the
+// given URIs, which must have been added with AddTracks. It returns the
+// playlist id.
+func (s *Server) AddPlaylist(ownerId, name string, uris ...string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := s.createPlaylist(ownerId, userModel.PlaylistDetails{Name: name})
+	for _, uri := range uris {
+		track, ok := s.tracks[uri]
+		if !ok {
+			panic("spotifytest: unknown track " + uri)
+		}
+		p.items = append(p.items, s.newItem(ownerId, track))
+	}
+
+	return p.Id
+}
+
+// SaveTracks adds the tracks with the given URIs, which must have been added
+// with AddTracks, to the user's liked songs. Like Spotify, the most recently
+// saved track comes first.
+func (s *Server) SaveTracks(userId string, uris ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, uri := range uris {
+		track, ok := s.tracks[uri]
+		if !ok {
+			panic("spotifytest: unknown track " + uri)
+		}
+		saved := userModel.SavedTrack{AddedAt: time.Now().UTC().Format(time.RFC3339), Track: track}
+		s.savedTracks[userId] = append([]userModel.SavedTrack{saved}, s.savedTracks[userId]...)
+	}
+}
+
+// PlaylistUris returns the track URIs of the playlist in playlist order.
+func (s *Server) PlaylistUris(playlistId string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.playlists[playlistId]
+	if !ok {
+		return nil
+	}
+
+	uris := make([]string, len(p.items))
+	for i, item := range p.items {
+		uris[i] = item.Track.Uri
+	}
+	return uris
+}
+
+// UserPlaylistIds returns the ids of the playlists owned by the user.
+func (s *Server) UserPlaylistIds(userId string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.userPlaylists[userId]...)
+}
+
+// Authorize returns a single-use authorization code for the user, as the
+// authorize redirect would.
+func (s *Server) Authorize(userId string) string {
+	return s.AuthorizePKCE(userId, "")
+}
+
+// AuthorizePKCE is like Authorize for a login that sent an S256 PKCE code
+// challenge. The token endpoint then requires the matching code_verifier.
+func (s *Server) AuthorizePKCE(userId, challenge string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code := s.newId("code")
+	s.codes[code] = authorization{userId: userId, challenge: challenge}
+	return code
+}
+
+// SetLoginUser makes the authorize page log in as the user and redirect
+// straight back, as Spotify does once the user has granted access.
+func (s *Server) SetLoginUser(userId string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.loginUser = userId
+}
+
+// IssueTokens returns a fresh access and refresh token for the user.
+func (s *Server) IssueTokens(userId string) (string, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.issueTokens(userId)
+}
+
+// ExpireAccessToken makes the server reject accessToken with 401.
+func (s *Server) ExpireAccessToken(accessToken string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.accessTokens, accessToken)
+}
+
+func (s *Server) InjectFault(fault Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if fault.Count == 0 {
+		fault.Count = 1
+	}
+	s.faults = append(s.faults, &fault)
+}
+
+// Requests returns the Web API requests received so far.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Request(nil), s.requests...)
+}
+
+// CountRequests returns how many received Web API requests match method and
+// the path prefix.
+func (s *Server) CountRequests(method, path string) int {
+	count := 0
+	for _, r := range s.Requests() {
+		if r.Method == method && strings.HasPrefix(r.Path, path) {
+			count++
+		}
+	}
+	return count
+}
+
+func (s *Server) routes() http.Handler {
+	router := chi.NewRouter()
+
+	router.Get("/authorize", s.authorize)
+	router.Post("/api/token", s.token)
+
+	router.Route("/v1", func(r chi.Router) {
+		r.Use(s.record, s.fault, s.authenticate)
+
+		r.Get("/me", s.me)
+		r.Get("/me/tracks", s.getSavedTracks)
+		r.Get("/audio-features", s.getAudioFeatures)
+		r.Get("/users/{user}/playlists", s.getUserPlaylists)
+		r.Post("/users/{user}/playlists", s.postUserPlaylist)
+		r.Get("/playlists/{id}", s.getPlaylist)
+		r.Put("/playlists/{id}", s.putPlaylist)
+		r.Get("/playlists/{id}/tracks", s.getPlaylistTracks)
+		r.Put("/playlists/{id}/tracks", s.putPlaylistTracks)
+		r.Post("/playlists/{id}/tracks", s.postPlaylistTracks)
+		r.Delete("/playlists/{id}/tracks", s.deletePlaylistTracks)
+	})
+
+	return router
+}
+
+// newId must be called with s.mu held.
+func (s *Server) newId(prefix string) string {
+	s.nextId++
+	return fmt.Sprintf("%s%d", prefix, s.nextId)
+}
+
+// issueTokens must be called with s.mu held.
+func (s *Server) issueTokens(userId string) (string, string) {
+	accessToken := s.newId("access")
+	refreshToken := s.newId("refresh")
+	s.accessTokens[accessToken] = userId
+	s.refreshTokens[refreshToken] = userId
+	return accessToken, refreshToken
+}
+
+// createPlaylist must be called with s.mu held.
+func (s *Server) createPlaylist(ownerId string, details userModel.PlaylistDetails) *playlist {
+	p := &playlist{}
+	p.Id = s.newId("playlist")
+	p.Name = details.Name
+	p.Description = details.Description
+	p.Public = details.Public == nil || *details.Public
+	p.Collaborative = details.Collaborative != nil && *details.Collaborative
+	p.Type = "playlist"
+	p.Uri = "spotify:playlist:" + p.Id
+	p.Owner.Id = ownerId
+	p.Owner.Type = "user"
+	p.Owner.Uri = "spotify:user:" + ownerId
+	if user, ok := s.users[ownerId]; ok {
+		p.Owner.DisplayName = user.DisplayName
+	}
+
+	s.playlists[p.Id] = p
+	s.userPlaylists[ownerId] = append(s.userPlaylists[ownerId], p.Id)
+	p.changed()
+
+	return p
+}
+
+// newItem must be called with s.mu held.
+func (s *Server) newItem(userId string, track userModel.Track) userModel.PlaylistItem {
+	var item userModel.PlaylistItem
+	item.AddedAt = time.Now().UTC().Format(time.RFC3339)
+	item.AddedBy.Id = userId
+	item.AddedBy.Type = "user"
+	item.AddedBy.Uri = "spotify:user:" + userId
+	item.Track = track
+	return item
+}
+
+// changed bumps the snapshot id after a modification.
+func (p *playlist) changed() {
+	p.version++
+	p.SnapshotId = fmt.Sprintf("%s-v%d", p.Id, p.version)
+}
+
+// view returns the playlist as the Web API shows it.
+func (p *playlist) view() userModel.Playlist {
+	view := p.Playlist
+	view.Tracks.Total = len(p.items)
+	return view
+}
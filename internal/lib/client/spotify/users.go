@@ -0,0 +1,21 @@
+package spotify
+
+import (
+	userModel "SpotifySorter/models"
+	"encoding/json"
+)
+
+// CurrentUser returns the profile of the user the client acts for.
+func (c *Client) CurrentUser() (*userModel.User, error) {
+	response, err := c.Get("me")
+	if err != nil {
+		return nil, err
+	}
+
+	var user userModel.User
+	if err := json.Unmarshal(response, &user); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
@@ -0,0 +1,250 @@
+package duplicates
+
+import (
+	userModel "SpotifySorter/models"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Rule is a way of telling that two playlist items are the same song.
+type Rule string
+
+const (
+	// RuleTrackId matches the same Spotify track added more than once.
+	RuleTrackId Rule = "track_id"
+	// RuleIsrc matches the same recording on different releases, such as a
+	// single and its album.
+	RuleIsrc Rule = "isrc"
+	// RuleTitleArtist matches tracks with the same normalized title and
+	// primary artist, ignoring remaster and version suffixes.
+	RuleTitleArtist Rule = "title_artist"
+)
+
+// Rules are all rules, strictest first.
+var Rules = []Rule{RuleTrackId, RuleIsrc, RuleTitleArtist}
+
+// Keeper chooses which item of a duplicate group stays in the playlist.
+type Keeper string
+
+const (
+	KeepEarliest Keeper = "earliest_added"
+	KeepPopular  Keeper = "most_popular"
+	KeepExplicit Keeper = "explicit"
+)
+
+var (
+	ErrUnknownRule   = errors.New("unknown duplicate rule")
+	ErrUnknownKeeper = errors.New("unknown keeper")
+	ErrNoKeeper      = errors.New("no keeper chosen for duplicate group")
+	ErrManyKeepers   = errors.New("more than one keeper chosen for duplicate group")
+)
+
+// Group is a set of playlist positions holding the same song. Rule is the
+// loosest rule needed to connect them.
+type Group struct {
+	Rule      Rule  `json:"rule"`
+	Positions []int `json:"positions"`
+}
+
+// Find returns the duplicate groups among items under the given rules, in
+// order of their first position. Items matched by several rules end up in a
+// single group.
+func Find(items []userModel.PlaylistItem, rules []Rule) ([]Group, error) {
+	for _, rule := range rules {
+		if !slices.Contains(Rules, rule) {
+			return nil, ErrUnknownRule
+		}
+	}
+
+	parent := make([]int, len(items))
+	for i := range parent {
+		parent[i] = i
+	}
+	rootRule := make(map[int]Rule)
+
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	// Rules are applied strictest first, so the rule of the last merge into a
+	// group is the loosest one it needed.
+	for _, rule := range Rules {
+		if !slices.Contains(rules, rule) {
+			continue
+		}
+
+		first := make(map[string]int)
+		for i := range items {
+			key := matchKey(&items[i], rule)
+			if key == "" {
+				continue
+			}
+
+			j, ok := first[key]
+			if !ok {
+				first[key] = i
+				continue
+			}
+
+			a, b := find(i), find(j)
+			if a == b {
+				continue
+			}
+			root := min(a, b)
+			parent[max(a, b)] = root
+			rootRule[root] = rule
+		}
+	}
+
+	byRoot := make(map[int]*Group)
+	var groups []*Group
+	for i := range items {
+		root := find(i)
+		rule, ok := rootRule[root]
+		if !ok {
+			continue
+		}
+
+		group, ok := byRoot[root]
+		if !ok {
+			group = &Group{Rule: rule}
+			byRoot[root] = group
+			groups = append(groups, group)
+		}
+		group.Positions = append(group.Positions, i)
+	}
+
+	result := make([]Group, len(groups))
+	for i, group := range groups {
+		result[i] = *group
+	}
+	return result, nil
+}
+
+// Remove returns the positions to remove so that only one item of every group
+// stays. For KeepExplicit, keepers lists the positions to keep, exactly one
+// per group.
+func Remove(items []userModel.PlaylistItem, groups []Group, keeper Keeper, keepers []int) ([]int, error) {
+	var remove []int
+
+	for _, group := range groups {
+		keep := -1
+
+		switch keeper {
+		case KeepEarliest:
+			for _, position := range group.Positions {
+				if keep == -1 || addedAt(&items[position]).Before(addedAt(&items[keep])) {
+					keep = position
+				}
+			}
+		case KeepPopular:
+			for _, position := range group.Positions {
+				if keep == -1 || items[position].Track.Popularity > items[keep].Track.Popularity {
+					keep = position
+				}
+			}
+		case KeepExplicit:
+			for _, position := range group.Positions {
+				if !slices.Contains(keepers, position) {
+					continue
+				}
+				if keep != -1 {
+					return nil, ErrManyKeepers
+				}
+				keep = position
+			}
+			if keep == -1 {
+				return nil, ErrNoKeeper
+			}
+		default:
+			return nil, ErrUnknownKeeper
+		}
+
+		for _, position := range group.Positions {
+			if position != keep {
+				remove = append(remove, position)
+			}
+		}
+	}
+
+	return remove, nil
+}
+
+func matchKey(item *userModel.PlaylistItem, rule Rule) string {
+	track := &item.Track
+
+	switch rule {
+	case RuleTrackId:
+		if item.IsLocal {
+			return ""
+		}
+		return track.Id
+	case RuleIsrc:
+		return strings.ToUpper(track.ExternalIds.Isrc)
+	case RuleTitleArtist:
+		if len(track.Artists) == 0 {
+			return ""
+		}
+		title := normalize(stripVersion(track.Name))
+		artist := normalize(track.Artists[0].Name)
+		if title == "" || artist == "" {
+			return ""
+		}
+		return title + "\x00" + artist
+	}
+
+	return ""
+}
+
+// stripVersion drops bracketed parts and " - " suffixes, which Spotify uses
+// for versions such as "(Remastered 2011)" or " - Radio Edit".
+func stripVersion(title string) string {
+	if i := strings.Index(title, " - "); i > 0 {
+		title = title[:i]
+	}
+
+	var b strings.Builder
+	depth := 0
+	for _, r := range title {
+		switch r {
+		case '(', '[':
+			depth++
+		case ')', ']':
+			if depth > 0 {
+				depth--
+			}
+		default:
+			if depth == 0 {
+				b.WriteRune(r)
+			}
+		}
+	}
+
+	return b.String()
+}
+
+// normalize lowercases s and keeps only letters and digits, separated by
+// single spaces.
+func normalize(s string) string {
+	fields := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(fields, " ")
+}
+
+// addedAt parses the added_at timestamp. Items without one, such as very old
+// additions, count as the earliest.
+func addedAt(item *userModel.PlaylistItem) time.Time {
+	t, err := time.Parse(time.RFC3339, item.AddedAt)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
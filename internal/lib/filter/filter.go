@@ -0,0 +1,436 @@
+// Package filter implements a small expression language for selecting
+// playlist tracks, such as
+//
+//	year >= 1990 and artist ~ "Radiohead" and duration < 5m and not explicit
+//
+// Expressions combine comparisons of track fields with and, or, not and
+// parentheses. Strings compare case-insensitively and ~ tests whether a string
+// contains another. Durations are written with a unit, e.g. 90s or 3m30s.
+package filter
+
+import (
+	userModel "SpotifySorter/models"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Error is a syntax or type error in a filter. Pos is the 1-based position
+// of the offending token.
+type Error struct {
+	Pos int
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("filter: %s at position %d", e.Msg, e.Pos)
+}
+
+func errorf(pos int, format string, args ...any) *Error {
+	return &Error{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+type kind int
+
+const (
+	kindBool kind = iota
+	kindNumber
+	kindString
+	kindDuration
+)
+
+func (k kind) String() string {
+	switch k {
+	case kindBool:
+		return "boolean"
+	case kindNumber:
+		return "number"
+	case kindString:
+		return "string"
+	default:
+		return "duration"
+	}
+}
+
+// value holds the result of an expression; which field is set depends on its
+// kind. Durations are stored in milliseconds in num.
+type value struct {
+	num float64
+	str string
+	b   bool
+}
+
+type expr struct {
+	kind kind
+	pos  int
+	eval func(item *userModel.PlaylistItem) value
+}
+
+type field struct {
+	kind kind
+	get  func(item *userModel.PlaylistItem) value
+}
+
+var fields = map[string]field{
+	"name":         stringField(func(t *userModel.Track) string { return t.Name }),
+	"artist":       stringField(primaryArtist),
+	"artists":      stringField(allArtists),
+	"album":        stringField(func(t *userModel.Track) string { return t.Album.Name }),
+	"album_type":   stringField(func(t *userModel.Track) string { return t.Album.AlbumType }),
+	"release_date": stringField(func(t *userModel.Track) string { return t.Album.ReleaseDate }),
+	"isrc":         stringField(func(t *userModel.Track) string { return t.ExternalIds.Isrc }),
+	"year":         numberField(releaseYear),
+	"popularity":   numberField(func(t *userModel.Track) float64 { return float64(t.Popularity) }),
+	"track_number": numberField(func(t *userModel.Track) float64 { return float64(t.TrackNumber) }),
+	"disc_number":  numberField(func(t *userModel.Track) float64 { return float64(t.DiscNumber) }),
+	"duration": {kindDuration, func(item *userModel.PlaylistItem) value {
+		return value{num: float64(item.Track.DurationMs)}
+	}},
+	"explicit": {kindBool, func(item *userModel.PlaylistItem) value {
+		return value{b: item.Track.Explicit}
+	}},
+	"local": {kindBool, func(item *userModel.PlaylistItem) value {
+		return value{b: item.IsLocal}
+	}},
+	"added_at": {kindString, func(item *userModel.PlaylistItem) value {
+		return value{str: item.AddedAt}
+	}},
+}
+
+// Filter is a compiled filter expression.
+type Filter struct {
+	match func(item *userModel.PlaylistItem) value
+}
+
+// Compile parses and type-checks src. Errors are of type *Error.
+func Compile(src string) (*Filter, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, errorf(t.pos, "unexpected %s", t)
+	}
+
+	if e.kind != kindBool {
+		return nil, errorf(e.pos, "filter must be a condition, not a %s", e.kind)
+	}
+
+	return &Filter{match: e.eval}, nil
+}
+
+// Match reports whether item satisfies the filter.
+func (f *Filter) Match(item *userModel.PlaylistItem) bool {
+	return f.match(item).b
+}
+
+// Apply returns the items that satisfy the filter, in their original order.
+func (f *Filter) Apply(items []userModel.PlaylistItem) []userModel.PlaylistItem {
+	matched := []userModel.PlaylistItem{}
+	for i := range items {
+		if f.Match(&items[i]) {
+			matched = append(matched, items[i])
+		}
+	}
+	return matched
+}
+
+type parser struct {
+	tokens []token
+	i      int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.i]
+	if t.kind != tokenEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) keyword(word string) (token, bool) {
+	t := p.peek()
+	if t.kind == tokenIdent && t.text == word {
+		return p.next(), true
+	}
+	return t, false
+}
+
+func (p *parser) parseOr() (*expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		op, ok := p.keyword("or")
+		if !ok {
+			return left, nil
+		}
+
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := checkBool(op, left, right); err != nil {
+			return nil, err
+		}
+
+		l, r := left.eval, right.eval
+		left = &expr{kind: kindBool, pos: left.pos, eval: func(item *userModel.PlaylistItem) value {
+			return value{b: l(item).b || r(item).b}
+		}}
+	}
+}
+
+func (p *parser) parseAnd() (*expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		op, ok := p.keyword("and")
+		if !ok {
+			return left, nil
+		}
+
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := checkBool(op, left, right); err != nil {
+			return nil, err
+		}
+
+		l, r := left.eval, right.eval
+		left = &expr{kind: kindBool, pos: left.pos, eval: func(item *userModel.PlaylistItem) value {
+			return value{b: l(item).b && r(item).b}
+		}}
+	}
+}
+
+func (p *parser) parseNot() (*expr, error) {
+	op, ok := p.keyword("not")
+	if !ok {
+		return p.parseComparison()
+	}
+
+	operand, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	if operand.kind != kindBool {
+		return nil, errorf(operand.pos, "not needs a condition, not a %s", operand.kind)
+	}
+
+	eval := operand.eval
+	return &expr{kind: kindBool, pos: op.pos, eval: func(item *userModel.PlaylistItem) value {
+		return value{b: !eval(item).b}
+	}}, nil
+}
+
+func (p *parser) parseComparison() (*expr, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	op := p.peek()
+	if op.kind != tokenOp {
+		return left, nil
+	}
+	p.next()
+
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	return compare(op, left, right)
+}
+
+func (p *parser) parseOperand() (*expr, error) {
+	t := p.next()
+
+	switch t.kind {
+	case tokenLParen:
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenRParen {
+			return nil, errorf(closing.pos, "expected \")\", found %s", closing)
+		}
+		return e, nil
+
+	case tokenNumber, tokenDuration:
+		k := kindNumber
+		if t.kind == tokenDuration {
+			k = kindDuration
+		}
+		v := value{num: t.num}
+		return &expr{kind: k, pos: t.pos, eval: func(*userModel.PlaylistItem) value { return v }}, nil
+
+	case tokenString:
+		v := value{str: t.str}
+		return &expr{kind: kindString, pos: t.pos, eval: func(*userModel.PlaylistItem) value { return v }}, nil
+
+	case tokenIdent:
+		switch t.text {
+		case "true", "false":
+			v := value{b: t.text == "true"}
+			return &expr{kind: kindBool, pos: t.pos, eval: func(*userModel.PlaylistItem) value { return v }}, nil
+		case "and", "or", "not":
+			return nil, errorf(t.pos, "expected a field or value, found %s", t)
+		}
+
+		f, ok := fields[t.text]
+		if !ok {
+			return nil, errorf(t.pos, "unknown field %s", t)
+		}
+		return &expr{kind: f.kind, pos: t.pos, eval: f.get}, nil
+	}
+
+	return nil, errorf(t.pos, "expected a field or value, found %s", t)
+}
+
+func checkBool(op token, left, right *expr) error {
+	for _, e := range []*expr{left, right} {
+		if e.kind != kindBool {
+			return errorf(e.pos, "%s needs conditions on both sides, not a %s", op.text, e.kind)
+		}
+	}
+	return nil
+}
+
+// compare type-checks a comparison and builds its evaluator.
+func compare(op token, left, right *expr) (*expr, error) {
+	if left.kind != right.kind {
+		msg := fmt.Sprintf("cannot compare %s with %s", left.kind, right.kind)
+		if left.kind == kindDuration || right.kind == kindDuration {
+			msg += "; write durations with a unit, such as 5m or 90s"
+		}
+		return nil, errorf(op.pos, "%s", msg)
+	}
+
+	ordered := op.text == "<" || op.text == "<=" || op.text == ">" || op.text == ">="
+	contains := op.text == "~" || op.text == "!~"
+
+	switch {
+	case left.kind == kindBool && (ordered || contains):
+		return nil, errorf(op.pos, "operator %s cannot be used with booleans", op.text)
+	case left.kind != kindString && contains:
+		return nil, errorf(op.pos, "operator %s can only be used with strings", op.text)
+	}
+
+	l, r := left.eval, right.eval
+	var cmp func(a, b value) bool
+
+	switch left.kind {
+	case kindNumber, kindDuration:
+		cmp = func(a, b value) bool { return a.num == b.num }
+	case kindBool:
+		cmp = func(a, b value) bool { return a.b == b.b }
+	case kindString:
+		cmp = func(a, b value) bool { return strings.EqualFold(a.str, b.str) }
+		if contains {
+			cmp = func(a, b value) bool {
+				return strings.Contains(strings.ToLower(a.str), strings.ToLower(b.str))
+			}
+		}
+	}
+
+	var test func(a, b value) bool
+	switch op.text {
+	case "=", "==", "~":
+		test = cmp
+	case "!=", "!~":
+		test = func(a, b value) bool { return !cmp(a, b) }
+	default:
+		test = ordering(op.text, left.kind)
+	}
+
+	return &expr{kind: kindBool, pos: left.pos, eval: func(item *userModel.PlaylistItem) value {
+		return value{b: test(l(item), r(item))}
+	}}, nil
+}
+
+// ordering returns the test for <, <=, > or >=. Strings are compared
+// case-insensitively, which orders ISO dates correctly.
+func ordering(op string, k kind) func(a, b value) bool {
+	compare := func(a, b value) int {
+		switch {
+		case k == kindString:
+			return strings.Compare(strings.ToLower(a.str), strings.ToLower(b.str))
+		case a.num < b.num:
+			return -1
+		case a.num > b.num:
+			return 1
+		}
+		return 0
+	}
+
+	switch op {
+	case "<":
+		return func(a, b value) bool { return compare(a, b) < 0 }
+	case "<=":
+		return func(a, b value) bool { return compare(a, b) <= 0 }
+	case ">":
+		return func(a, b value) bool { return compare(a, b) > 0 }
+	default:
+		return func(a, b value) bool { return compare(a, b) >= 0 }
+	}
+}
+
+func stringField(get func(t *userModel.Track) string) field {
+	return field{kindString, func(item *userModel.PlaylistItem) value {
+		return value{str: get(&item.Track)}
+	}}
+}
+
+func numberField(get func(t *userModel.Track) float64) field {
+	return field{kindNumber, func(item *userModel.PlaylistItem) value {
+		return value{num: get(&item.Track)}
+	}}
+}
+
+func primaryArtist(t *userModel.Track) string {
+	if len(t.Artists) == 0 {
+		return ""
+	}
+	return t.Artists[0].Name
+}
+
+func allArtists(t *userModel.Track) string {
+	names := make([]string, len(t.Artists))
+	for i, artist := range t.Artists {
+		names[i] = artist.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// releaseYear returns the year of the album's release date, or 0 if unknown.
+func releaseYear(t *userModel.Track) float64 {
+	date := t.Album.ReleaseDate
+	year, err := strconv.Atoi(date[:min(4, len(date))])
+	if err != nil {
+		return 0
+	}
+	return float64(year)
+}
@@ -0,0 +1,205 @@
+package filter
+
+import (
+	userModel "SpotifySorter/models"
+	"errors"
+	"testing"
+)
+
+type track struct {
+	name     string
+	artist   string
+	date     string
+	duration int
+	explicit bool
+}
+
+func (t track) item() *userModel.PlaylistItem {
+	item := &userModel.PlaylistItem{}
+	item.Track.Name = t.name
+	item.Track.Artists = []userModel.Artist{{Name: t.artist}}
+	item.Track.Album.ReleaseDate = t.date
+	item.Track.DurationMs = t.duration
+	item.Track.Explicit = t.explicit
+	return item
+}
+
+func TestExample(t *testing.T) {
+	f, err := Compile(`year >= 1990 and artist ~ "Radiohead" and duration < 5m and not explicit`)
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		track track
+		want  bool
+	}{
+		{"match", track{"Karma Police", "Radiohead", "1997-05-21", 264000, false}, true},
+		{"artist case-insensitive", track{"Karma Police", "RADIOHEAD", "1997", 264000, false}, true},
+		{"too old", track{"Creep", "Radiohead", "1989-09-21", 238000, false}, false},
+		{"other artist", track{"Teardrop", "Massive Attack", "1998-04-20", 330000, false}, false},
+		{"too long", track{"Paranoid Android", "Radiohead", "1997-05-21", 383000, false}, false},
+		{"explicit", track{"Karma Police", "Radiohead", "1997-05-21", 264000, true}, false},
+		{"unknown date", track{"Karma Police", "Radiohead", "", 264000, false}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := f.Match(tt.track.item()); got != tt.want {
+				t.Errorf("Match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		// and binds tighter than or.
+		{"true or false and false", true},
+		{"(true or false) and false", false},
+		{"false and false or true", true},
+		// not binds tighter than and.
+		{"not false and false", false},
+		{"not (false and false)", true},
+		{"not not true", true},
+		{"not true or true", true},
+		// Comparisons bind tighter than not.
+		{"not year = 1997", false},
+		{"not year = 2000", true},
+	}
+
+	item := track{"Karma Police", "Radiohead", "1997-05-21", 264000, false}.item()
+	for _, tt := range tests {
+		f, err := Compile(tt.src)
+		if err != nil {
+			t.Errorf("Compile(%q): %v", tt.src, err)
+			continue
+		}
+		if got := f.Match(item); got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestDurations(t *testing.T) {
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{"duration = 264s", true},
+		{"duration = 4m24s", true},
+		{"duration < 5m", true},
+		{"duration < 4m", false},
+		{"duration >= 4m24s", true},
+		{"duration > 4m24s", false},
+		{"duration <= 4.5m", true},
+		{"duration != 264000ms", false},
+	}
+
+	item := track{"Karma Police", "Radiohead", "1997-05-21", 264000, false}.item()
+	for _, tt := range tests {
+		f, err := Compile(tt.src)
+		if err != nil {
+			t.Errorf("Compile(%q): %v", tt.src, err)
+			continue
+		}
+		if got := f.Match(item); got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestContains(t *testing.T) {
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{`name ~ "police"`, true},
+		{`name ~ "POLICE"`, true},
+		{`name ~ "live"`, false},
+		{`name !~ "live"`, true},
+		{`name !~ "karma"`, false},
+		{`artist ~ ""`, true},
+		{`name = "karma police"`, true},
+		{`name != "Karma Police"`, false},
+	}
+
+	item := track{"Karma Police", "Radiohead", "1997-05-21", 264000, false}.item()
+	for _, tt := range tests {
+		f, err := Compile(tt.src)
+		if err != nil {
+			t.Errorf("Compile(%q): %v", tt.src, err)
+			continue
+		}
+		if got := f.Match(item); got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	f, err := Compile(`artist = "Radiohead"`)
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+
+	items := []userModel.PlaylistItem{
+		*track{name: "Creep", artist: "Radiohead"}.item(),
+		*track{name: "Teardrop", artist: "Massive Attack"}.item(),
+		*track{name: "Airbag", artist: "Radiohead"}.item(),
+	}
+
+	got := f.Apply(items)
+	if len(got) != 2 || got[0].Track.Name != "Creep" || got[1].Track.Name != "Airbag" {
+		t.Errorf("Apply kept %d items, want Creep and Airbag in order", len(got))
+	}
+
+	if got := f.Apply(nil); got == nil || len(got) != 0 {
+		t.Errorf("Apply(nil) = %v, want an empty slice", got)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		src string
+		pos int
+	}{
+		// Syntax errors.
+		{`year >=`, 8},
+		{`year >= 1990 and`, 17},
+		{`year # 1990`, 6},
+		{`name = "Creep`, 8},
+		{`(year > 1990`, 13},
+		{`year > 1990)`, 12},
+		{`explicit explicit`, 10},
+		{`year > 5x`, 8},
+		{`tempo > 120`, 1},
+		{`and explicit`, 1},
+		// Type errors.
+		{`duration < 5`, 10},
+		{`year = "1997"`, 6},
+		{`year ~ "19"`, 6},
+		{`explicit > true`, 10},
+		{`popularity and explicit`, 1},
+		{`explicit or name`, 13},
+		{`not year`, 5},
+		{`year`, 1},
+	}
+
+	for _, tt := range tests {
+		_, err := Compile(tt.src)
+
+		var filterErr *Error
+		if !errors.As(err, &filterErr) {
+			t.Errorf("Compile(%q) returned %v, want an *Error", tt.src, err)
+			continue
+		}
+		if filterErr.Pos != tt.pos {
+			t.Errorf("Compile(%q) failed at position %d, want %d: %v", tt.src, filterErr.Pos, tt.pos, err)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package filter
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenNumber
+	tokenDuration
+	tokenString
+	tokenOp
+	tokenLParen
+	tokenRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+	num  float64
+	str  string
+}
+
+func (t token) String() string {
+	if t.kind == tokenEOF {
+		return "end of filter"
+	}
+	return strconv.Quote(t.text)
+}
+
+var operators = []string{"==", "!=", "<=", ">=", "!~", "=", "<", ">", "~"}
+
+// lex splits src into tokens. Positions are 1-based byte offsets.
+func lex(src string) ([]token, error) {
+	var tokens []token
+
+	for i := 0; i < len(src); {
+		c := src[i]
+		pos := i + 1
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenLParen, text: "(", pos: pos})
+			i++
+
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenRParen, text: ")", pos: pos})
+			i++
+
+		case c == '"':
+			end := i + 1
+			for end < len(src) && src[end] != '"' {
+				if src[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(src) {
+				return nil, errorf(pos, "unterminated string")
+			}
+
+			text := src[i : end+1]
+			str, err := strconv.Unquote(text)
+			if err != nil {
+				return nil, errorf(pos, "invalid string %s", text)
+			}
+			tokens = append(tokens, token{kind: tokenString, text: text, pos: pos, str: str})
+			i = end + 1
+
+		case isDigit(c):
+			end := i
+			for end < len(src) && (isDigit(src[end]) || src[end] == '.' || isLetter(src[end])) {
+				end++
+			}
+			text := src[i:end]
+
+			t, err := number(text, pos)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, t)
+			i = end
+
+		case isLetter(c):
+			end := i
+			for end < len(src) && (isLetter(src[end]) || isDigit(src[end])) {
+				end++
+			}
+			text := strings.ToLower(src[i:end])
+			tokens = append(tokens, token{kind: tokenIdent, text: text, pos: pos})
+			i = end
+
+		default:
+			op := ""
+			for _, candidate := range operators {
+				if strings.HasPrefix(src[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, errorf(pos, "unexpected character %q", c)
+			}
+			tokens = append(tokens, token{kind: tokenOp, text: op, pos: pos})
+			i += len(op)
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF, pos: len(src) + 1}), nil
+}
+
+// number lexes a number or, when it has a unit such as "5m" or "3m30s", a
+// duration.
+func number(text string, pos int) (token, error) {
+	if value, err := strconv.ParseFloat(text, 64); err == nil {
+		return token{kind: tokenNumber, text: text, pos: pos, num: value}, nil
+	}
+
+	d, err := time.ParseDuration(text)
+	if err != nil {
+		return token{}, errorf(pos, "invalid number or duration %q", text)
+	}
+
+	return token{kind: tokenDuration, text: text, pos: pos, num: float64(d.Milliseconds())}, nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
@@ -0,0 +1,191 @@
+package harmonic
+
+import (
+	userModel "SpotifySorter/models"
+	"math"
+	"strconv"
+)
+
+const (
+	// tempoTolerance is the relative tempo change, in percent, that costs as
+	// much as one step on the Camelot wheel.
+	tempoTolerance = 6.0
+	// maxCost is the transition cost at which a transition scores zero.
+	maxCost = 4.0
+	// window bounds how far apart the two edges swapped by a 2-opt move may be,
+	// which keeps large playlists fast while still fixing local crossings.
+	window = 200
+	// maxPasses bounds the number of 2-opt improvement passes.
+	maxPasses = 20
+)
+
+// Camelot returns the Camelot wheel code, e.g. "8B", of a Spotify pitch
+// class (0 = C, -1 = unknown) and mode (1 = major, 0 = minor), or "" if the
+// key is unknown.
+func Camelot(key, mode int) string {
+	number, minor, ok := camelot(key, mode)
+	if !ok {
+		return ""
+	}
+
+	if minor {
+		return strconv.Itoa(number) + "A"
+	}
+	return strconv.Itoa(number) + "B"
+}
+
+func camelot(key, mode int) (int, bool, bool) {
+	if key < 0 || key > 11 {
+		return 0, false, false
+	}
+
+	// A minor key sits on the same number as its relative major, three
+	// semitones up. Going round the wheel adds a fifth (7 semitones).
+	minor := mode == 0
+	if minor {
+		key = (key + 3) % 12
+	}
+
+	return (7*key+7)%12 + 1, minor, true
+}
+
+// KeyDistance returns the number of steps between two keys on the Camelot
+// wheel: moving to a neighbouring number or switching between major and
+// minor each count as one step. Keys one step apart or less mix
+// harmonically. Unknown keys are treated as clashing.
+func KeyDistance(a, b *userModel.AudioFeatures) int {
+	numberA, minorA, okA := camelot(a.Key, a.Mode)
+	numberB, minorB, okB := camelot(b.Key, b.Mode)
+	if !okA || !okB {
+		return 7
+	}
+
+	d := numberA - numberB
+	if d < 0 {
+		d = -d
+	}
+	d = min(d, 12-d)
+
+	if minorA != minorB {
+		d++
+	}
+
+	return d
+}
+
+// TempoDistance returns the relative tempo change between two tracks in
+// percent, allowing for half and double time mixing.
+func TempoDistance(a, b *userModel.AudioFeatures) float64 {
+	if a.Tempo <= 0 || b.Tempo <= 0 {
+		return 0
+	}
+
+	distance := math.Inf(1)
+	for _, ratio := range []float64{0.5, 1, 2} {
+		from := a.Tempo * ratio
+		distance = min(distance, math.Abs(from-b.Tempo)/math.Max(from, b.Tempo)*100)
+	}
+
+	return distance
+}
+
+// Cost returns the cost of mixing from a into b. Zero is a perfect
+// transition; every Camelot step and every tempoTolerance percent of tempo
+// change add one.
+func Cost(a, b *userModel.AudioFeatures) float64 {
+	return float64(KeyDistance(a, b)) + TempoDistance(a, b)/tempoTolerance
+}
+
+// Score rates the transitions of tracks played in order from 0 (every
+// transition clashes) to 100 (same key and tempo throughout).
+func Score(tracks []userModel.AudioFeatures, order []int) float64 {
+	if len(order) < 2 {
+		return 100
+	}
+
+	total := 0.0
+	for i := 1; i < len(order); i++ {
+		total += math.Max(0, 1-Cost(&tracks[order[i-1]], &tracks[order[i]])/maxCost)
+	}
+
+	return total / float64(len(order)-1) * 100
+}
+
+// Order returns an order of tracks, as indices into tracks, in which
+// consecutive tracks are harmonically compatible and change tempo smoothly.
+// It starts from the first track, greedily appends the cheapest next track
+// and then improves the path with 2-opt moves.
+func Order(tracks []userModel.AudioFeatures) []int {
+	n := len(tracks)
+	if n == 0 {
+		return []int{}
+	}
+
+	order := make([]int, 0, n)
+	used := make([]bool, n)
+	order = append(order, 0)
+	used[0] = true
+
+	for len(order) < n {
+		last := &tracks[order[len(order)-1]]
+
+		next, best := -1, math.Inf(1)
+		for i := range tracks {
+			if used[i] {
+				continue
+			}
+			if c := Cost(last, &tracks[i]); c < best {
+				next, best = i, c
+			}
+		}
+
+		order = append(order, next)
+		used[next] = true
+	}
+
+	twoOpt(tracks, order)
+
+	return order
+}
+
+// twoOpt reverses segments of the path while that lowers its total cost. The
+// first track stays in place.
+func twoOpt(tracks []userModel.AudioFeatures, order []int) {
+	n := len(order)
+	cost := func(i, j int) float64 {
+		return Cost(&tracks[order[i]], &tracks[order[j]])
+	}
+
+	for pass := 0; pass < maxPasses; pass++ {
+		improved := false
+
+		for i := 0; i < n-2; i++ {
+			for j := i + 2; j < n && j <= i+window; j++ {
+				// Reversing order[i+1..j] replaces edges (i, i+1) and
+				// (j, j+1) with (i, j) and (i+1, j+1). The path is open, so
+				// at the end there is no edge after j.
+				before := cost(i, i+1)
+				after := cost(i, j)
+				if j+1 < n {
+					before += cost(j, j+1)
+					after += cost(i+1, j+1)
+				}
+
+				if after < before-1e-9 {
+					reverse(order[i+1 : j+1])
+					improved = true
+				}
+			}
+		}
+
+		if !improved {
+			return
+		}
+	}
+}
+
+func reverse(s []int) {
+	for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
+		s[i], s[j] = s[j], s[i]
+	}
+}
@@ -0,0 +1,200 @@
+package harmonic
+
+import (
+	userModel "SpotifySorter/models"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+func TestCamelot(t *testing.T) {
+	tests := []struct {
+		key, mode int
+		want      string
+	}{
+		{0, 1, "8B"},  // C major
+		{9, 0, "8A"},  // A minor
+		{7, 1, "9B"},  // G major
+		{4, 0, "9A"},  // E minor
+		{5, 1, "7B"},  // F major
+		{2, 0, "7A"},  // D minor
+		{11, 1, "1B"}, // B major
+		{8, 0, "1A"},  // G♯ minor
+		{4, 1, "12B"}, // E major
+		{1, 0, "12A"}, // C♯ minor
+		{-1, 1, ""},
+		{12, 0, ""},
+	}
+
+	for _, tt := range tests {
+		if got := Camelot(tt.key, tt.mode); got != tt.want {
+			t.Errorf("Camelot(%d, %d) = %q, want %q", tt.key, tt.mode, got, tt.want)
+		}
+	}
+
+	// Every key and mode has its own code.
+	seen := make(map[string]bool)
+	for key := 0; key < 12; key++ {
+		for mode := 0; mode < 2; mode++ {
+			code := Camelot(key, mode)
+			if seen[code] {
+				t.Errorf("Camelot(%d, %d) = %q is not unique", key, mode, code)
+			}
+			seen[code] = true
+		}
+	}
+}
+
+// camelotKey returns the features of a track at tempo in the key with the
+// given Camelot code.
+func camelotKey(t *testing.T, code string, tempo float64) userModel.AudioFeatures {
+	t.Helper()
+
+	for key := 0; key < 12; key++ {
+		for mode := 0; mode < 2; mode++ {
+			if Camelot(key, mode) == code {
+				return userModel.AudioFeatures{Key: key, Mode: mode, Tempo: tempo}
+			}
+		}
+	}
+	t.Fatalf("no key has Camelot code %q", code)
+	return userModel.AudioFeatures{}
+}
+
+func TestKeyDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"8B", "8B", 0},
+		{"8B", "9B", 1},
+		{"8B", "7B", 1},
+		{"8B", "8A", 1},
+		{"12B", "1B", 1},
+		{"8B", "9A", 2},
+		{"8A", "6A", 2},
+		{"8B", "2B", 6},
+		{"8B", "2A", 7},
+	}
+
+	for _, tt := range tests {
+		a, b := camelotKey(t, tt.a, 120), camelotKey(t, tt.b, 120)
+		if got := KeyDistance(&a, &b); got != tt.want {
+			t.Errorf("KeyDistance(%s, %s) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := KeyDistance(&b, &a); got != tt.want {
+			t.Errorf("KeyDistance(%s, %s) = %d, want %d", tt.b, tt.a, got, tt.want)
+		}
+	}
+
+	known := camelotKey(t, "8B", 120)
+	unknown := userModel.AudioFeatures{Key: -1, Tempo: 120}
+	if got := KeyDistance(&known, &unknown); got != 7 {
+		t.Errorf("KeyDistance to an unknown key = %d, want 7", got)
+	}
+}
+
+func TestTempoDistance(t *testing.T) {
+	tests := []struct {
+		a, b float64
+		want float64
+	}{
+		{120, 120, 0},
+		{120, 126, 6.0 / 126 * 100},
+		{126, 120, 6.0 / 126 * 100},
+		{60, 120, 0},
+		{170, 85, 0},
+		{100, 150, 25},
+		{0, 120, 0},
+	}
+
+	for _, tt := range tests {
+		a := userModel.AudioFeatures{Tempo: tt.a}
+		b := userModel.AudioFeatures{Tempo: tt.b}
+		if got := TempoDistance(&a, &b); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("TempoDistance(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		name  string
+		codes []string
+		tempo []float64
+		want  float64
+	}{
+		{"single track", []string{"8B"}, []float64{120}, 100},
+		{"same key and tempo", []string{"8B", "8B", "8B"}, []float64{120, 120, 120}, 100},
+		{"neighbouring keys", []string{"8B", "9B", "10B"}, []float64{120, 120, 120}, 75},
+		{"clashing keys", []string{"8B", "2B", "8B"}, []float64{120, 120, 120}, 0},
+		// 6% faster costs one Camelot step.
+		{"tempo change", []string{"8B", "8B"}, []float64{120, 127.66}, 75},
+		{"mixed", []string{"8B", "8B", "2A"}, []float64{120, 120, 120}, 50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracks := make([]userModel.AudioFeatures, len(tt.codes))
+			order := make([]int, len(tt.codes))
+			for i, code := range tt.codes {
+				tracks[i] = camelotKey(t, code, tt.tempo[i])
+				order[i] = i
+			}
+
+			if got := Score(tracks, order); math.Abs(got-tt.want) > 0.1 {
+				t.Errorf("Score = %.2f, want %.2f", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrderWalksTheWheel(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+
+	tracks := make([]userModel.AudioFeatures, 12)
+	for i, number := range rng.Perm(12) {
+		tracks[i] = camelotKey(t, fmt.Sprintf("%dB", number+1), 120)
+	}
+
+	order := Order(tracks)
+	if order[0] != 0 {
+		t.Errorf("Order starts with track %d, want the first", order[0])
+	}
+	for i := 1; i < len(order); i++ {
+		if d := KeyDistance(&tracks[order[i-1]], &tracks[order[i]]); d != 1 {
+			t.Errorf("transition %d is %d Camelot steps, want 1", i, d)
+		}
+	}
+	if got := Score(tracks, order); got != 75 {
+		t.Errorf("Score = %.2f, want 75", got)
+	}
+}
+
+func TestOrderRandom(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+
+	for i := 0; i < 50; i++ {
+		tracks := make([]userModel.AudioFeatures, rng.IntN(60))
+		for j := range tracks {
+			tracks[j] = userModel.AudioFeatures{Key: rng.IntN(13) - 1, Mode: rng.IntN(2), Tempo: 80 + rng.Float64()*80}
+		}
+
+		order := Order(tracks)
+
+		sorted := slices.Sorted(slices.Values(order))
+		for j, position := range sorted {
+			if position != j {
+				t.Fatalf("Order returned %v, not a permutation of %d tracks", order, len(tracks))
+			}
+		}
+		if len(order) > 0 && order[0] != 0 {
+			t.Fatalf("Order starts with track %d, want the first", order[0])
+		}
+		if again := Order(tracks); !slices.Equal(again, order) {
+			t.Fatalf("Order is not deterministic: %v, then %v", order, again)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+// Package keyset holds the keys that sign and verify the backend's access
+// tokens. Tokens name their key in the kid header, so a new signing key can
+// be introduced while tokens signed with the previous one stay valid until
+// they expire. Asymmetric keys (RS256, EdDSA) are published as a JWK Set so
+// other services can verify tokens without sharing a secret.
+package keyset
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// minRSABits is the smallest RSA key accepted.
+const minRSABits = 2048
+
+var (
+	ErrNoKeys       = errors.New("no keys configured")
+	ErrNoSigningKey = errors.New("signing key not found")
+	ErrUnknownKey   = errors.New("unknown key")
+)
+
+// Spec describes a key. HS256 keys read their secret from the environment
+// variable SecretEnv. RS256 and EdDSA keys are read from PEM files: a key
+// with PrivateKey can sign, a key with only PublicKey can only verify.
+type Spec struct {
+	Id         string
+	Algorithm  string
+	SecretEnv  string
+	PrivateKey string
+	PublicKey  string
+}
+
+type key struct {
+	id     string
+	method jwt.SigningMethod
+	sign   any
+	verify any
+}
+
+// Keyset signs tokens with one key and verifies them with any of its keys.
+type Keyset struct {
+	signing *key
+	keys    map[string]*key
+	ids     []string
+	methods []string
+}
+
+// New loads the keys of specs. signingId names the key that signs new tokens.
+func New(signingId string, specs []Spec) (*Keyset, error) {
+	if len(specs) == 0 {
+		return nil, ErrNoKeys
+	}
+
+	ks := &Keyset{keys: make(map[string]*key, len(specs))}
+	seen := make(map[string]bool)
+
+	for _, spec := range specs {
+		if spec.Id == "" {
+			return nil, errors.New("keyset: key without id")
+		}
+		if ks.keys[spec.Id] != nil {
+			return nil, fmt.Errorf("keyset: duplicate key %q", spec.Id)
+		}
+
+		k, err := load(spec)
+		if err != nil {
+			return nil, fmt.Errorf("keyset: key %q: %w", spec.Id, err)
+		}
+
+		ks.keys[spec.Id] = k
+		ks.ids = append(ks.ids, spec.Id)
+		if alg := k.method.Alg(); !seen[alg] {
+			seen[alg] = true
+			ks.methods = append(ks.methods, alg)
+		}
+	}
+
+	ks.signing = ks.keys[signingId]
+	if ks.signing == nil {
+		return nil, fmt.Errorf("keyset: %w: %q", ErrNoSigningKey, signingId)
+	}
+	if ks.signing.sign == nil {
+		return nil, fmt.Errorf("keyset: key %q has no private key and cannot sign", signingId)
+	}
+
+	return ks, nil
+}
+
+func load(spec Spec) (*key, error) {
+	k := &key{id: spec.Id}
+
+	switch spec.Algorithm {
+	case AlgorithmHS256:
+		secret := os.Getenv(spec.SecretEnv)
+		if spec.SecretEnv == "" || secret == "" {
+			return nil, fmt.Errorf("secret %q is not set", spec.SecretEnv)
+		}
+		k.method = jwt.SigningMethodHS256
+		k.sign = []byte(secret)
+		k.verify = []byte(secret)
+
+	case AlgorithmRS256:
+		k.method = jwt.SigningMethodRS256
+		if spec.PrivateKey != "" {
+			private, err := readPEM(spec.PrivateKey, jwt.ParseRSAPrivateKeyFromPEM)
+			if err != nil {
+				return nil, err
+			}
+			k.sign, k.verify = private, &private.PublicKey
+		} else {
+			public, err := readPEM(spec.PublicKey, jwt.ParseRSAPublicKeyFromPEM)
+			if err != nil {
+				return nil, err
+			}
+			k.verify = public
+		}
+		if bits := k.verify.(*rsa.PublicKey).N.BitLen(); bits < minRSABits {
+			return nil, fmt.Errorf("RSA key has %d bits, at least %d are required", bits, minRSABits)
+		}
+
+	case AlgorithmEdDSA:
+		k.method = jwt.SigningMethodEdDSA
+		if spec.PrivateKey != "" {
+			private, err := readPEM(spec.PrivateKey, jwt.ParseEdPrivateKeyFromPEM)
+			if err != nil {
+				return nil, err
+			}
+			edKey, ok := private.(ed25519.PrivateKey)
+			if !ok {
+				return nil, errors.New("not an Ed25519 private key")
+			}
+			k.sign, k.verify = edKey, edKey.Public().(ed25519.PublicKey)
+		} else {
+			public, err := readPEM(spec.PublicKey, jwt.ParseEdPublicKeyFromPEM)
+			if err != nil {
+				return nil, err
+			}
+			edKey, ok := public.(ed25519.PublicKey)
+			if !ok {
+				return nil, errors.New("not an Ed25519 public key")
+			}
+			k.verify = edKey
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", spec.Algorithm)
+	}
+
+	return k, nil
+}
+
+func readPEM[T any](path string, parse func([]byte) (T, error)) (T, error) {
+	var zero T
+	if path == "" {
+		return zero, errors.New("no PEM file configured")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return zero, err
+	}
+
+	return parse(data)
+}
+
+// Sign signs claims with the signing key and names it in the kid header.
+func (ks *Keyset) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.signing.method, claims)
+	token.Header["kid"] = ks.signing.id
+	return token.SignedString(ks.signing.sign)
+}
+
+// Keyfunc is a jwt.Keyfunc that returns the verification key named by the
+// token's kid header, provided the token uses that key's algorithm.
+func (ks *Keyset) Keyfunc(token *jwt.Token) (any, error) {
+	id, _ := token.Header["kid"].(string)
+
+	k := ks.keys[id]
+	if k == nil {
+		return nil, ErrUnknownKey
+	}
+
+	if token.Method.Alg() != k.method.Alg() {
+		return nil, fmt.Errorf("key %q is not a %s key", id, token.Method.Alg())
+	}
+
+	return k.verify, nil
+}
+
+// Methods returns the algorithms of the keys, for jwt.WithValidMethods.
+func (ks *Keyset) Methods() []string {
+	return ks.methods
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys of the asymmetric keys. HS256 secrets are
+// never published, so tokens signed with them can only be verified here.
+func (ks *Keyset) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+
+	for _, id := range ks.ids {
+		k := ks.keys[id]
+		jwk := JWK{Use: "sig", Alg: k.method.Alg(), Kid: id}
+
+		switch public := k.verify.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set
+}
@@ -0,0 +1,383 @@
+package keyset
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// writePEM writes a PEM block to a file in a temporary directory and returns
+// its path.
+func writePEM(t *testing.T, blockType string, der []byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return path
+}
+
+// edKeys generates an Ed25519 key pair and returns the paths of its private
+// and public key files.
+func edKeys(t *testing.T) (string, string, ed25519.PublicKey) {
+	t.Helper()
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	return writePEM(t, "PRIVATE KEY", marshalPKCS8(t, private)), writePEM(t, "PUBLIC KEY", marshalPKIX(t, public)), public
+}
+
+// rsaKeys generates an RSA key pair of the given size and returns the paths
+// of its private and public key files.
+func rsaKeys(t *testing.T, bits int) (string, string, *rsa.PublicKey) {
+	t.Helper()
+
+	private, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	return writePEM(t, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(private)), writePEM(t, "PUBLIC KEY", marshalPKIX(t, &private.PublicKey)), &private.PublicKey
+}
+
+func marshalPKCS8(t *testing.T, key any) []byte {
+	t.Helper()
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey: %v", err)
+	}
+	return der
+}
+
+func marshalPKIX(t *testing.T, key any) []byte {
+	t.Helper()
+
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey: %v", err)
+	}
+	return der
+}
+
+func sign(t *testing.T, ks *Keyset) string {
+	t.Helper()
+
+	token, err := ks.Sign(jwt.RegisteredClaims{Subject: "1"})
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	return token
+}
+
+func parse(ks *Keyset, token string) error {
+	_, err := jwt.ParseWithClaims(token, &jwt.RegisteredClaims{}, ks.Keyfunc, jwt.WithValidMethods(ks.Methods()))
+	return err
+}
+
+func TestRotation(t *testing.T) {
+	t.Setenv("JWT_SECRET", "secret")
+	edPrivate, _, _ := edKeys(t)
+	rsaPrivate, _, _ := rsaKeys(t, 2048)
+
+	specs := []Spec{
+		{Id: "hs", Algorithm: AlgorithmHS256, SecretEnv: "JWT_SECRET"},
+		{Id: "ed", Algorithm: AlgorithmEdDSA, PrivateKey: edPrivate},
+		{Id: "rs", Algorithm: AlgorithmRS256, PrivateKey: rsaPrivate},
+	}
+
+	keysets := make(map[string]*Keyset)
+	for _, spec := range specs {
+		ks, err := New(spec.Id, specs)
+		if err != nil {
+			t.Fatalf("New(%q): %v", spec.Id, err)
+		}
+		keysets[spec.Id] = ks
+	}
+
+	if got, want := keysets["hs"].Methods(), []string{"HS256", "EdDSA", "RS256"}; !slices.Equal(got, want) {
+		t.Errorf("Methods() = %v, want %v", got, want)
+	}
+
+	for id, signer := range keysets {
+		token := sign(t, signer)
+
+		parsed, _, err := new(jwt.Parser).ParseUnverified(token, &jwt.RegisteredClaims{})
+		if err != nil {
+			t.Fatalf("ParseUnverified: %v", err)
+		}
+		if kid := parsed.Header["kid"]; kid != id {
+			t.Errorf("token signed with %q has kid %v", id, kid)
+		}
+
+		// Every keyset holding the key verifies the token, whichever key
+		// it signs with.
+		for verifierId, verifier := range keysets {
+			if err := parse(verifier, token); err != nil {
+				t.Errorf("token signed with %q rejected by the keyset signing with %q: %v", id, verifierId, err)
+			}
+		}
+	}
+}
+
+func TestKeyfunc(t *testing.T) {
+	t.Setenv("JWT_SECRET", "secret")
+	edPrivate, _, _ := edKeys(t)
+
+	ks, err := New("ed", []Spec{
+		{Id: "hs", Algorithm: AlgorithmHS256, SecretEnv: "JWT_SECRET"},
+		{Id: "ed", Algorithm: AlgorithmEdDSA, PrivateKey: edPrivate},
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	hsToken := func(kid any) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{Subject: "1"})
+		if kid != nil {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString([]byte("secret"))
+		if err != nil {
+			t.Fatalf("SignedString: %v", err)
+		}
+		return signed
+	}
+
+	if err := parse(ks, hsToken("hs")); err != nil {
+		t.Errorf("HS256 token with its own kid rejected: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"missing kid", hsToken(nil), ErrUnknownKey},
+		{"unknown kid", hsToken("old"), ErrUnknownKey},
+		{"kid is not a string", hsToken(1), ErrUnknownKey},
+		// An HS256 token naming the EdDSA key must not be checked against
+		// the public key as if it were a secret.
+		{"mismatched algorithm", hsToken("ed"), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := parse(ks, tt.token)
+			if err == nil {
+				t.Fatal("token accepted, want it rejected")
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("parse returned %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// The mismatch is reported by Keyfunc itself.
+	token, _, err := new(jwt.Parser).ParseUnverified(hsToken("ed"), &jwt.RegisteredClaims{})
+	if err != nil {
+		t.Fatalf("ParseUnverified: %v", err)
+	}
+	if _, err := ks.Keyfunc(token); err == nil || !strings.Contains(err.Error(), "not a HS256 key") {
+		t.Errorf("Keyfunc returned %v, want an algorithm mismatch", err)
+	}
+}
+
+func TestVerifyOnly(t *testing.T) {
+	edPrivate, edPublic, _ := edKeys(t)
+	rsaPrivate, rsaPublic, _ := rsaKeys(t, 2048)
+
+	signers := map[string]Spec{
+		"ed": {Id: "ed", Algorithm: AlgorithmEdDSA, PrivateKey: edPrivate},
+		"rs": {Id: "rs", Algorithm: AlgorithmRS256, PrivateKey: rsaPrivate},
+	}
+	verifiers := []Spec{
+		{Id: "ed", Algorithm: AlgorithmEdDSA, PublicKey: edPublic},
+		{Id: "rs", Algorithm: AlgorithmRS256, PublicKey: rsaPublic},
+	}
+
+	for id, spec := range signers {
+		signer, err := New(id, []Spec{spec})
+		if err != nil {
+			t.Fatalf("New(%q): %v", id, err)
+		}
+
+		// A public key cannot sign...
+		if _, err := New(id, verifiers); err == nil {
+			t.Errorf("New signing with the public key %q succeeded, want an error", id)
+		}
+
+		// ...but verifies next to a key that can.
+		verifier, err := New("local", append([]Spec{{Id: "local", Algorithm: AlgorithmEdDSA, PrivateKey: edPrivate}}, verifiers...))
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		if err := parse(verifier, sign(t, signer)); err != nil {
+			t.Errorf("token signed with %q rejected by its public key: %v", id, err)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	t.Setenv("JWT_SECRET", "secret")
+	t.Setenv("EMPTY_SECRET", "")
+
+	edPrivate, edPublic, _ := edKeys(t)
+	rsaPrivate, rsaPublic, _ := rsaKeys(t, 2048)
+	smallRSA, smallRSAPublic, _ := rsaKeys(t, 1024)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	rsaPKCS8 := writePEM(t, "PRIVATE KEY", marshalPKCS8(t, rsaKey))
+
+	tests := []struct {
+		name string
+		spec Spec
+		ok   bool
+	}{
+		{"HS256", Spec{Algorithm: AlgorithmHS256, SecretEnv: "JWT_SECRET"}, true},
+		{"HS256 unset secret", Spec{Algorithm: AlgorithmHS256, SecretEnv: "MISSING_SECRET"}, false},
+		{"HS256 empty secret", Spec{Algorithm: AlgorithmHS256, SecretEnv: "EMPTY_SECRET"}, false},
+		{"HS256 no variable", Spec{Algorithm: AlgorithmHS256}, false},
+		{"EdDSA private", Spec{Algorithm: AlgorithmEdDSA, PrivateKey: edPrivate}, true},
+		{"EdDSA public", Spec{Algorithm: AlgorithmEdDSA, PublicKey: edPublic}, true},
+		{"EdDSA from RSA file", Spec{Algorithm: AlgorithmEdDSA, PrivateKey: rsaPKCS8}, false},
+		{"EdDSA no file", Spec{Algorithm: AlgorithmEdDSA}, false},
+		{"RS256 PKCS1 private", Spec{Algorithm: AlgorithmRS256, PrivateKey: rsaPrivate}, true},
+		{"RS256 PKCS8 private", Spec{Algorithm: AlgorithmRS256, PrivateKey: rsaPKCS8}, true},
+		{"RS256 public", Spec{Algorithm: AlgorithmRS256, PublicKey: rsaPublic}, true},
+		{"RS256 from Ed25519 file", Spec{Algorithm: AlgorithmRS256, PrivateKey: edPrivate}, false},
+		{"RS256 1024 bit private", Spec{Algorithm: AlgorithmRS256, PrivateKey: smallRSA}, false},
+		{"RS256 1024 bit public", Spec{Algorithm: AlgorithmRS256, PublicKey: smallRSAPublic}, false},
+		{"RS256 missing file", Spec{Algorithm: AlgorithmRS256, PrivateKey: filepath.Join(t.TempDir(), "missing.pem")}, false},
+		{"unknown algorithm", Spec{Algorithm: "ES256", PrivateKey: edPrivate}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := load(tt.spec)
+			if tt.ok && err != nil {
+				t.Errorf("load: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Error("load succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	t.Setenv("JWT_SECRET", "secret")
+	hs := Spec{Id: "hs", Algorithm: AlgorithmHS256, SecretEnv: "JWT_SECRET"}
+
+	if _, err := New("hs", nil); !errors.Is(err, ErrNoKeys) {
+		t.Errorf("New without keys returned %v, want %v", err, ErrNoKeys)
+	}
+	if _, err := New("other", []Spec{hs}); !errors.Is(err, ErrNoSigningKey) {
+		t.Errorf("New with an unknown signing key returned %v, want %v", err, ErrNoSigningKey)
+	}
+	if _, err := New("hs", []Spec{hs, hs}); err == nil {
+		t.Error("New with a duplicate key id succeeded, want an error")
+	}
+	if _, err := New("", []Spec{{Algorithm: AlgorithmHS256, SecretEnv: "JWT_SECRET"}}); err == nil {
+		t.Error("New with a key without id succeeded, want an error")
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	t.Setenv("JWT_SECRET", "secret")
+	edPrivate, _, edPublic := edKeys(t)
+	_, rsaPublicFile, rsaPublic := rsaKeys(t, 2048)
+
+	ks, err := New("hs", []Spec{
+		{Id: "hs", Algorithm: AlgorithmHS256, SecretEnv: "JWT_SECRET"},
+		{Id: "ed", Algorithm: AlgorithmEdDSA, PrivateKey: edPrivate},
+		{Id: "rs", Algorithm: AlgorithmRS256, PublicKey: rsaPublicFile},
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	data, err := json.Marshal(ks.JWKS())
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	var set struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	// The HS256 secret is never published.
+	if len(set.Keys) != 2 {
+		t.Fatalf("JWKS has %d keys, want ed and rs: %s", len(set.Keys), data)
+	}
+
+	ed, rs := set.Keys[0], set.Keys[1]
+	for _, field := range []string{"kty", "crv", "x", "use", "alg", "kid"} {
+		if _, ok := ed[field]; !ok {
+			t.Errorf("Ed25519 JWK has no %q: %s", field, data)
+		}
+	}
+	if ed["kty"] != "OKP" || ed["crv"] != "Ed25519" || ed["alg"] != "EdDSA" || ed["kid"] != "ed" || ed["use"] != "sig" {
+		t.Errorf("Ed25519 JWK = %v", ed)
+	}
+	if x, err := base64.RawURLEncoding.DecodeString(ed["x"]); err != nil || !edPublic.Equal(ed25519.PublicKey(x)) {
+		t.Errorf("Ed25519 JWK x = %q does not decode to the public key", ed["x"])
+	}
+	if _, ok := ed["n"]; ok {
+		t.Errorf("Ed25519 JWK has RSA fields: %v", ed)
+	}
+
+	if rs["kty"] != "RSA" || rs["alg"] != "RS256" || rs["kid"] != "rs" || rs["use"] != "sig" {
+		t.Errorf("RSA JWK = %v", rs)
+	}
+	n, errN := base64.RawURLEncoding.DecodeString(rs["n"])
+	e, errE := base64.RawURLEncoding.DecodeString(rs["e"])
+	if errN != nil || errE != nil {
+		t.Fatalf("RSA JWK n or e is not base64url: %v", rs)
+	}
+	decoded := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	if !rsaPublic.Equal(decoded) {
+		t.Errorf("RSA JWK does not decode to the public key")
+	}
+	if rs["e"] != "AQAB" {
+		t.Errorf("RSA JWK e = %q, want AQAB for 65537", rs["e"])
+	}
+}
+
+func TestJWKSEmpty(t *testing.T) {
+	t.Setenv("JWT_SECRET", "secret")
+
+	ks, err := New("hs", []Spec{{Id: "hs", Algorithm: AlgorithmHS256, SecretEnv: "JWT_SECRET"}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	data, err := json.Marshal(ks.JWKS())
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if string(data) != `{"keys":[]}` {
+		t.Errorf("JWKS = %s, want an empty key list", data)
+	}
+}
@@ -0,0 +1,96 @@
+package merge
+
+import (
+	"SpotifySorter/internal/lib/duplicates"
+	"SpotifySorter/internal/lib/sorter"
+	userModel "SpotifySorter/models"
+	"errors"
+)
+
+// Mode is how the items of several playlists are combined.
+type Mode string
+
+const (
+	// ModeConcatenate appends the playlists one after another.
+	ModeConcatenate Mode = "concatenate"
+	// ModeRoundRobin takes one item from each playlist in turn.
+	ModeRoundRobin Mode = "round_robin"
+	// ModeSorted concatenates the playlists and sorts the result.
+	ModeSorted Mode = "sorted"
+)
+
+// dedupeRules decide which merged items are the same song.
+var dedupeRules = []duplicates.Rule{duplicates.RuleTrackId, duplicates.RuleIsrc}
+
+var ErrUnknownMode = errors.New("unknown merge mode")
+
+// Merge combines sources into a single list of items. specs are only used by
+// ModeSorted.
+func Merge(sources [][]userModel.PlaylistItem, mode Mode, specs []sorter.Spec) ([]userModel.PlaylistItem, error) {
+	var merged []userModel.PlaylistItem
+
+	switch mode {
+	case ModeConcatenate, ModeSorted:
+		for _, source := range sources {
+			merged = append(merged, source...)
+		}
+	case ModeRoundRobin:
+		for i := 0; ; i++ {
+			added := false
+			for _, source := range sources {
+				if i < len(source) {
+					merged = append(merged, source[i])
+					added = true
+				}
+			}
+			if !added {
+				break
+			}
+		}
+	default:
+		return nil, ErrUnknownMode
+	}
+
+	if mode != ModeSorted {
+		return merged, nil
+	}
+
+	order, err := sorter.OrderBy(merged, specs)
+	if err != nil {
+		return nil, err
+	}
+
+	sorted := make([]userModel.PlaylistItem, len(order))
+	for i, position := range order {
+		sorted[i] = merged[position]
+	}
+	return sorted, nil
+}
+
+// Dedupe drops items that are the same song as an earlier item or as any item
+// of existing, such as the current contents of the target playlist. It returns
+// the remaining items and the number dropped.
+func Dedupe(items, existing []userModel.PlaylistItem) ([]userModel.PlaylistItem, int, error) {
+	all := append(append([]userModel.PlaylistItem{}, existing...), items...)
+
+	groups, err := duplicates.Find(all, dedupeRules)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	drop := make(map[int]bool)
+	for _, group := range groups {
+		for _, position := range group.Positions[1:] {
+			drop[position] = true
+		}
+	}
+
+	kept := make([]userModel.PlaylistItem, 0, len(items))
+	for i, item := range items {
+		if !drop[len(existing)+i] {
+			kept = append(kept, item)
+		}
+	}
+
+	return kept, len(items) - len(kept), nil
+}
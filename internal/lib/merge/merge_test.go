@@ -0,0 +1,156 @@
+package merge
+
+import (
+	"SpotifySorter/internal/lib/sorter"
+	userModel "SpotifySorter/models"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// item returns a playlist item named name, for the track id and ISRC.
+func item(name, id, isrc string) userModel.PlaylistItem {
+	var item userModel.PlaylistItem
+	item.Track.Name = name
+	item.Track.Id = id
+	item.Track.ExternalIds.Isrc = isrc
+	return item
+}
+
+func names(items []userModel.PlaylistItem) []string {
+	names := make([]string, len(items))
+	for i, item := range items {
+		names[i] = item.Track.Name
+	}
+	return names
+}
+
+func TestMerge(t *testing.T) {
+	sources := [][]userModel.PlaylistItem{
+		{item("c", "1", ""), item("a", "2", ""), item("e", "3", "")},
+		{item("b", "4", "")},
+		{item("f", "5", ""), item("d", "6", "")},
+	}
+
+	tests := []struct {
+		mode  Mode
+		specs []sorter.Spec
+		want  []string
+	}{
+		{ModeConcatenate, nil, []string{"c", "a", "e", "b", "f", "d"}},
+		{ModeRoundRobin, nil, []string{"c", "b", "f", "a", "d", "e"}},
+		{ModeSorted, []sorter.Spec{{Key: sorter.KeyName, Direction: sorter.DirectionAsc}}, []string{"a", "b", "c", "d", "e", "f"}},
+		{ModeSorted, []sorter.Spec{{Key: sorter.KeyName, Direction: sorter.DirectionDesc}}, []string{"f", "e", "d", "c", "b", "a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			merged, err := Merge(sources, tt.mode, tt.specs)
+			if err != nil {
+				t.Fatalf("Merge: %v", err)
+			}
+			if got := names(merged); !slices.Equal(got, tt.want) {
+				t.Errorf("Merge = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeErrors(t *testing.T) {
+	sources := [][]userModel.PlaylistItem{{item("a", "1", "")}}
+
+	if _, err := Merge(sources, "zip", nil); !errors.Is(err, ErrUnknownMode) {
+		t.Errorf("Merge in mode zip returned %v, want %v", err, ErrUnknownMode)
+	}
+	if _, err := Merge(sources, ModeSorted, nil); !errors.Is(err, sorter.ErrNoKeys) {
+		t.Errorf("sorted Merge without keys returned %v, want %v", err, sorter.ErrNoKeys)
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	tests := []struct {
+		name     string
+		items    []userModel.PlaylistItem
+		existing []userModel.PlaylistItem
+		want     []string
+		skipped  int
+	}{
+		{
+			name:  "nothing to drop",
+			items: []userModel.PlaylistItem{item("a", "1", "A"), item("b", "2", "B")},
+			want:  []string{"a", "b"},
+		},
+		{
+			name:    "later copies of a track",
+			items:   []userModel.PlaylistItem{item("a", "1", ""), item("b", "2", ""), item("a again", "1", ""), item("a thrice", "1", "")},
+			want:    []string{"a", "b"},
+			skipped: 2,
+		},
+		{
+			name:    "same recording on another release",
+			items:   []userModel.PlaylistItem{item("single", "1", "GBAYE0601498"), item("album", "2", "gbaye0601498")},
+			want:    []string{"single"},
+			skipped: 1,
+		},
+		{
+			name:     "already in the target",
+			items:    []userModel.PlaylistItem{item("a", "1", ""), item("b", "2", ""), item("c", "3", "C")},
+			existing: []userModel.PlaylistItem{item("target b", "2", ""), item("target c", "9", "C")},
+			want:     []string{"a"},
+			skipped:  2,
+		},
+		{
+			// Copies inside the target are the target's business.
+			name:     "duplicates within the target",
+			items:    []userModel.PlaylistItem{item("a", "1", "")},
+			existing: []userModel.PlaylistItem{item("x", "9", ""), item("x again", "9", "")},
+			want:     []string{"a"},
+		},
+		{
+			name:     "in the target and repeated",
+			items:    []userModel.PlaylistItem{item("a", "1", ""), item("a again", "1", ""), item("b", "2", "")},
+			existing: []userModel.PlaylistItem{item("target a", "1", "")},
+			want:     []string{"b"},
+			skipped:  2,
+		},
+		{
+			// Tracks without an id or ISRC cannot be matched and are kept.
+			name:    "unidentified tracks",
+			items:   []userModel.PlaylistItem{item("x", "", ""), item("x", "", "")},
+			want:    []string{"x", "x"},
+			skipped: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept, skipped, err := Dedupe(tt.items, tt.existing)
+			if err != nil {
+				t.Fatalf("Dedupe: %v", err)
+			}
+			if got := names(kept); !slices.Equal(got, tt.want) {
+				t.Errorf("Dedupe kept %v, want %v", got, tt.want)
+			}
+			if skipped != tt.skipped {
+				t.Errorf("Dedupe skipped %d, want %d", skipped, tt.skipped)
+			}
+			if len(kept)+skipped != len(tt.items) {
+				t.Errorf("kept %d and skipped %d of %d items", len(kept), skipped, len(tt.items))
+			}
+		})
+	}
+}
+
+func TestDedupeLocalFiles(t *testing.T) {
+	local := item("local", "", "")
+	local.IsLocal = true
+	local.Track.Id = "local-id"
+
+	kept, skipped, err := Dedupe([]userModel.PlaylistItem{local, local}, []userModel.PlaylistItem{local})
+	if err != nil {
+		t.Fatalf("Dedupe: %v", err)
+	}
+	if len(kept) != 2 || skipped != 0 {
+		t.Errorf("Dedupe kept %d and skipped %d local files, want both kept", len(kept), skipped)
+	}
+}
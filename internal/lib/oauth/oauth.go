@@ -0,0 +1,159 @@
+// Package oauth protects the authorization code flow: a signed, short-lived
+// state ties the callback to a login started here, a binding kept in the
+// browser ties it to the browser that started the login (CSRF protection),
+// and a PKCE verifier kept server-side ties the code to that login.
+package oauth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidState = errors.New("invalid state")
+	ErrStateExpired = errors.New("state expired")
+)
+
+// States issues and verifies login states. Each state maps to the PKCE
+// verifier of its login, held in memory until the state is used or expires,
+// so a state can only be used once and only on the instance that issued it.
+type States struct {
+	key []byte
+	ttl time.Duration
+
+	mu        sync.Mutex
+	verifiers map[string]pending
+}
+
+type pending struct {
+	verifier  string
+	expiresAt time.Time
+}
+
+// NewStates returns States whose states are valid for ttl. The signing key is
+// random, as states never outlive the process that stores their verifiers.
+func NewStates(ttl time.Duration) (*States, error) {
+	key, err := randomString(32)
+	if err != nil {
+		return nil, err
+	}
+
+	return &States{
+		key:       []byte(key),
+		ttl:       ttl,
+		verifiers: make(map[string]pending),
+	}, nil
+}
+
+// Issue starts a login. It returns the state to send to the authorize
+// endpoint together with the PKCE code challenge.
+func (s *States) Issue() (string, string, error) {
+	nonce, err := randomString(16)
+	if err != nil {
+		return "", "", err
+	}
+
+	verifier, err := randomString(64)
+	if err != nil {
+		return "", "", err
+	}
+
+	expiresAt := time.Now().Add(s.ttl)
+	payload := nonce + "." + strconv.FormatInt(expiresAt.Unix(), 10)
+	state := payload + "." + s.sign(payload)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purge()
+	s.verifiers[nonce] = pending{verifier: verifier, expiresAt: expiresAt}
+
+	return state, Challenge(verifier), nil
+}
+
+// Verify checks a state returned to the callback, and the binding the
+// browser that completes the login holds, and returns the PKCE verifier of
+// its login. A state is accepted only once.
+func (s *States) Verify(state, binding string) (string, error) {
+	parts := strings.Split(state, ".")
+	if len(parts) != 3 {
+		return "", ErrInvalidState
+	}
+
+	if !hmac.Equal([]byte(binding), []byte(Binding(state))) {
+		return "", ErrInvalidState
+	}
+
+	nonce, expiry, signature := parts[0], parts[1], parts[2]
+	if !hmac.Equal([]byte(signature), []byte(s.sign(nonce+"."+expiry))) {
+		return "", ErrInvalidState
+	}
+
+	seconds, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil {
+		return "", ErrInvalidState
+	}
+	if time.Now().After(time.Unix(seconds, 0)) {
+		return "", ErrStateExpired
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.verifiers[nonce]
+	if !ok {
+		return "", ErrInvalidState
+	}
+	delete(s.verifiers, nonce)
+
+	return p.verifier, nil
+}
+
+// Binding returns the value the browser starting the login with state keeps,
+// the hash of the state's nonce. A login can only be completed by a browser
+// holding it, so an attacker cannot make a victim complete the attacker's
+// login.
+func Binding(state string) string {
+	nonce, _, _ := strings.Cut(state, ".")
+	sum := sha256.Sum256([]byte(nonce))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Challenge returns the S256 PKCE code challenge of verifier.
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func (s *States) sign(payload string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// purge drops abandoned logins. It must be called with s.mu held.
+func (s *States) purge() {
+	now := time.Now()
+	for nonce, p := range s.verifiers {
+		if now.After(p.expiresAt) {
+			delete(s.verifiers, nonce)
+		}
+	}
+}
+
+// randomString returns n random bytes, base64url encoded. 64 bytes give an
+// 86 character verifier, within the 43 to 128 characters PKCE allows.
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,176 @@
+package oauth
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newStates(t *testing.T, ttl time.Duration) *States {
+	t.Helper()
+
+	s, err := NewStates(ttl)
+	if err != nil {
+		t.Fatalf("NewStates: %v", err)
+	}
+	return s
+}
+
+func issue(t *testing.T, s *States) (string, string) {
+	t.Helper()
+
+	state, challenge, err := s.Issue()
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	return state, challenge
+}
+
+func TestVerify(t *testing.T) {
+	s := newStates(t, time.Minute)
+	state, challenge := issue(t, s)
+
+	verifier, err := s.Verify(state, Binding(state))
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if Challenge(verifier) != challenge {
+		t.Errorf("the verifier does not match the challenge sent with the state")
+	}
+	if n := len(verifier); n < 43 || n > 128 {
+		t.Errorf("verifier has %d characters, PKCE allows 43 to 128", n)
+	}
+}
+
+func TestVerifyReplay(t *testing.T) {
+	s := newStates(t, time.Minute)
+	state, _ := issue(t, s)
+
+	if _, err := s.Verify(state, Binding(state)); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	// The verifier is handed out once, so a replayed callback cannot
+	// exchange another code with it.
+	verifier, err := s.Verify(state, Binding(state))
+	if !errors.Is(err, ErrInvalidState) {
+		t.Errorf("second Verify returned %v, want %v", err, ErrInvalidState)
+	}
+	if verifier != "" {
+		t.Errorf("second Verify returned verifier %q, want none", verifier)
+	}
+}
+
+func TestVerifiersDiffer(t *testing.T) {
+	s := newStates(t, time.Minute)
+
+	seen := make(map[string]bool)
+	for i := 0; i < 10; i++ {
+		state, _ := issue(t, s)
+		verifier, err := s.Verify(state, Binding(state))
+		if err != nil {
+			t.Fatalf("Verify: %v", err)
+		}
+		if seen[verifier] {
+			t.Fatalf("verifier %q issued twice", verifier)
+		}
+		seen[verifier] = true
+	}
+}
+
+func TestVerifyTampered(t *testing.T) {
+	s := newStates(t, time.Minute)
+	other := newStates(t, time.Minute)
+	state, _ := issue(t, s)
+	foreign, _ := issue(t, other)
+
+	parts := strings.Split(state, ".")
+	nonce, expiry, signature := parts[0], parts[1], parts[2]
+	later := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	otherNonce, _, _ := strings.Cut(foreign, ".")
+
+	tests := []struct {
+		name  string
+		state string
+	}{
+		{"empty", ""},
+		{"missing signature", nonce + "." + expiry},
+		{"extra part", state + ".x"},
+		{"extended expiry", nonce + "." + later + "." + signature},
+		{"other nonce", otherNonce + "." + expiry + "." + signature},
+		{"truncated signature", nonce + "." + expiry + "." + signature[:len(signature)-1]},
+		{"not a number", nonce + ".soon." + s.sign(nonce+".soon")},
+		{"signed by another instance", foreign},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The binding matches, so only the state itself is rejected.
+			if _, err := s.Verify(tt.state, Binding(tt.state)); !errors.Is(err, ErrInvalidState) {
+				t.Errorf("Verify returned %v, want %v", err, ErrInvalidState)
+			}
+		})
+	}
+
+	// Rejected attempts do not use up the login.
+	if _, err := s.Verify(state, Binding(state)); err != nil {
+		t.Errorf("Verify after the rejected attempts: %v", err)
+	}
+}
+
+func TestVerifyExpired(t *testing.T) {
+	s := newStates(t, -time.Minute)
+	state, _ := issue(t, s)
+
+	if _, err := s.Verify(state, Binding(state)); !errors.Is(err, ErrStateExpired) {
+		t.Errorf("Verify returned %v, want %v", err, ErrStateExpired)
+	}
+
+	// An expired login is dropped when the next one starts.
+	issue(t, s)
+	if n := len(s.verifiers); n != 1 {
+		t.Errorf("%d verifiers kept, want only the latest", n)
+	}
+}
+
+func TestVerifyBinding(t *testing.T) {
+	s := newStates(t, time.Minute)
+	state, _ := issue(t, s)
+	other, _ := issue(t, s)
+
+	tests := []struct {
+		name    string
+		binding string
+	}{
+		{"no cookie", ""},
+		{"other login", Binding(other)},
+		{"state itself", state},
+		{"truncated", Binding(state)[1:]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := s.Verify(state, tt.binding); !errors.Is(err, ErrInvalidState) {
+				t.Errorf("Verify returned %v, want %v", err, ErrInvalidState)
+			}
+		})
+	}
+
+	// A victim's browser presenting the wrong binding does not burn the
+	// login for the browser that started it.
+	if _, err := s.Verify(state, Binding(state)); err != nil {
+		t.Errorf("Verify with the right binding: %v", err)
+	}
+}
+
+func TestChallenge(t *testing.T) {
+	// The example of RFC 7636, appendix B.
+	const verifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	const want = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	if got := Challenge(verifier); got != want {
+		t.Errorf("Challenge(%q) = %q, want %q", verifier, got, want)
+	}
+}
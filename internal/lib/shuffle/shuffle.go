@@ -0,0 +1,126 @@
+package shuffle
+
+import (
+	userModel "SpotifySorter/models"
+	"math/rand"
+)
+
+// Options configure a spread shuffle. A track's artists may not reappear
+// within ArtistGap positions of it and its album not within AlbumGap
+// positions; a gap of 0 disables the constraint.
+type Options struct {
+	ArtistGap int
+	AlbumGap  int
+	Seed      int64
+}
+
+// Spread returns a random order of items, as indices into items, that keeps
+// tracks by the same artist or from the same album apart. The same seed
+// always gives the same order.
+//
+// When the playlist is dominated by a few artists the gaps cannot always be
+// kept; Spread then places the conflicting track that fits best and reports
+// the number of such violations.
+func Spread(items []userModel.PlaylistItem, opts Options) ([]int, int) {
+	rng := rand.New(rand.NewSource(opts.Seed))
+
+	remaining := rng.Perm(len(items))
+	artists := make([][]string, len(items))
+	albums := make([]string, len(items))
+	counts := make(map[string]int)
+	for i := range items {
+		artists[i] = artistKeys(&items[i].Track)
+		albums[i] = items[i].Track.Album.Id
+		if len(artists[i]) > 0 {
+			counts[artists[i][0]]++
+		}
+	}
+
+	lastArtist := make(map[string]int)
+	lastAlbum := make(map[string]int)
+	conflicts := func(i, position int) int {
+		n := 0
+		for _, artist := range artists[i] {
+			if last, ok := lastArtist[artist]; ok && position-last <= opts.ArtistGap {
+				n++
+			}
+		}
+		if last, ok := lastAlbum[albums[i]]; ok && albums[i] != "" && position-last <= opts.AlbumGap {
+			n++
+		}
+		return n
+	}
+
+	order := make([]int, 0, len(items))
+	violations := 0
+
+	for position := 0; len(remaining) > 0; position++ {
+		slots := len(remaining)
+
+		// pick is an index into remaining. Urgent tracks belong to artists with
+		// so many tracks left that they only fit if one is placed now; among
+		// the rest, artists with more tracks left are more likely to be picked.
+		pick, urgent, best, fewest := -1, false, -1, 0
+		total := 0
+		for r, i := range remaining {
+			c := conflicts(i, position)
+			if best == -1 || c < fewest {
+				best, fewest = r, c
+			}
+			if c > 0 {
+				continue
+			}
+
+			weight := 1
+			if len(artists[i]) > 0 {
+				weight = counts[artists[i][0]]
+				if !urgent && (weight-1)*(opts.ArtistGap+1)+1 >= slots {
+					pick, urgent = r, true
+				}
+			}
+
+			if urgent {
+				continue
+			}
+			total += weight
+			if rng.Intn(total) < weight {
+				pick = r
+			}
+		}
+
+		if pick == -1 {
+			pick = best
+			violations++
+		}
+
+		i := remaining[pick]
+		remaining = append(remaining[:pick], remaining[pick+1:]...)
+		order = append(order, i)
+
+		for _, artist := range artists[i] {
+			lastArtist[artist] = position
+		}
+		if len(artists[i]) > 0 {
+			counts[artists[i][0]]--
+		}
+		if albums[i] != "" {
+			lastAlbum[albums[i]] = position
+		}
+	}
+
+	return order, violations
+}
+
+// artistKeys identifies the artists of a track, falling back to names for
+// local files, which have no artist ids.
+func artistKeys(track *userModel.Track) []string {
+	keys := make([]string, 0, len(track.Artists))
+	for _, artist := range track.Artists {
+		if artist.Id != "" {
+			keys = append(keys, artist.Id)
+		} else if artist.Name != "" {
+			keys = append(keys, "name:"+artist.Name)
+		}
+	}
+	return keys
+}
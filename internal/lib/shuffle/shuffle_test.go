@@ -0,0 +1,186 @@
+package shuffle
+
+import (
+	userModel "SpotifySorter/models"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+type track struct {
+	artists []string
+	album   string
+}
+
+func items(tracks ...track) []userModel.PlaylistItem {
+	items := make([]userModel.PlaylistItem, len(tracks))
+	for i, t := range tracks {
+		for _, artist := range t.artists {
+			items[i].Track.Artists = append(items[i].Track.Artists, userModel.Artist{Id: artist, Name: artist})
+		}
+		items[i].Track.Album.Id = t.album
+	}
+	return items
+}
+
+// playlist returns perArtist tracks by each of the artists, every artist's
+// tracks on one album.
+func playlist(perArtist int, artists ...string) []userModel.PlaylistItem {
+	var tracks []track
+	for _, artist := range artists {
+		for i := 0; i < perArtist; i++ {
+			tracks = append(tracks, track{artists: []string{artist}, album: artist + "-album"})
+		}
+	}
+	return items(tracks...)
+}
+
+// conflicts counts the positions of order at which an artist or album of the
+// track appeared within the gaps before it.
+func conflicts(list []userModel.PlaylistItem, order []int, opts Options) int {
+	n := 0
+	for position, i := range order {
+		conflict := false
+		for back := 1; back <= position; back++ {
+			previous := &list[order[position-back]].Track
+			current := &list[i].Track
+
+			if back <= opts.ArtistGap {
+				for _, a := range current.Artists {
+					for _, b := range previous.Artists {
+						if a.Id == b.Id {
+							conflict = true
+						}
+					}
+				}
+			}
+			if back <= opts.AlbumGap && current.Album.Id != "" && current.Album.Id == previous.Album.Id {
+				conflict = true
+			}
+		}
+		if conflict {
+			n++
+		}
+	}
+	return n
+}
+
+func isPermutation(order []int, n int) bool {
+	sorted := slices.Sorted(slices.Values(order))
+	for i, position := range sorted {
+		if position != i {
+			return false
+		}
+	}
+	return len(order) == n
+}
+
+func TestSpreadSeed(t *testing.T) {
+	list := playlist(5, "a", "b", "c", "d")
+	opts := Options{ArtistGap: 2, Seed: 42}
+
+	first, _ := Spread(list, opts)
+	second, _ := Spread(list, opts)
+	if !slices.Equal(first, second) {
+		t.Errorf("the same seed gave %v, then %v", first, second)
+	}
+
+	distinct := 0
+	for seed := int64(0); seed < 10; seed++ {
+		order, _ := Spread(list, Options{ArtistGap: 2, Seed: seed})
+		if !slices.Equal(order, first) {
+			distinct++
+		}
+	}
+	if distinct == 0 {
+		t.Error("ten seeds all gave the same order")
+	}
+}
+
+// TestSpreadGaps checks that Spread reports exactly the positions at which it
+// could not keep the gaps, and that it keeps them when there is room to.
+// Spread is greedy, so a playlist that can just be spread, with no slack,
+// may still get violations.
+func TestSpreadGaps(t *testing.T) {
+	tests := []struct {
+		name  string
+		list  []userModel.PlaylistItem
+		opts  Options
+		keeps bool
+	}{
+		{"no constraints", playlist(3, "a", "b"), Options{}, true},
+		{"artist gap", playlist(4, "a", "b", "c", "d", "e"), Options{ArtistGap: 2}, true},
+		// Five tracks by a need four tracks of others between them.
+		{"urgent artist", playlist(5, "a", "b", "c", "d", "e"), Options{ArtistGap: 4}, true},
+		{"dominant artist", append(playlist(6, "a"), playlist(2, "b", "c", "d", "e", "f")...), Options{ArtistGap: 1}, true},
+		{"album gap", items(
+			track{[]string{"a"}, "x"}, track{[]string{"b"}, "x"}, track{[]string{"c"}, "x"},
+			track{[]string{"d"}, "y"}, track{[]string{"e"}, "y"}, track{[]string{"f"}, "y"},
+			track{[]string{"g"}, "z"}, track{[]string{"h"}, "z"}, track{[]string{"i"}, "z"},
+		), Options{AlbumGap: 2}, true},
+		{"featured artists", items(
+			track{[]string{"a", "b"}, ""}, track{[]string{"b"}, ""}, track{[]string{"c"}, ""},
+			track{[]string{"d"}, ""}, track{[]string{"a"}, ""}, track{[]string{"e"}, ""},
+		), Options{ArtistGap: 1}, false},
+		{"no slack", playlist(5, "a", "b", "c", "d"), Options{ArtistGap: 2}, false},
+		// Ten tracks by a and two by others cannot keep a's tracks three
+		// apart, so every order has conflicts that must be reported.
+		{"impossible", append(playlist(10, "a"), playlist(1, "b", "c")...), Options{ArtistGap: 3}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for seed := int64(0); seed < 50; seed++ {
+				opts := tt.opts
+				opts.Seed = seed
+
+				order, violations := Spread(tt.list, opts)
+				if !isPermutation(order, len(tt.list)) {
+					t.Fatalf("seed %d: %v is not a permutation of %d items", seed, order, len(tt.list))
+				}
+				if n := conflicts(tt.list, order, opts); n != violations {
+					t.Errorf("seed %d: %d violations reported, %d found in %v", seed, violations, n, order)
+				}
+				if tt.keeps && violations != 0 {
+					t.Errorf("seed %d: %d violations, want none", seed, violations)
+				}
+			}
+		})
+	}
+}
+
+func TestArtistKeys(t *testing.T) {
+	track := &userModel.Track{Artists: []userModel.Artist{
+		{Id: "1", Name: "Radiohead"},
+		{Name: "Local Band"},
+		{},
+	}}
+
+	want := []string{"1", "name:Local Band"}
+	if got := artistKeys(track); !slices.Equal(got, want) {
+		t.Errorf("artistKeys = %v, want %v", got, want)
+	}
+}
+
+func TestSpreadLocalFiles(t *testing.T) {
+	// Local files have artist names but no ids.
+	list := make([]userModel.PlaylistItem, 6)
+	for i := range list {
+		list[i].IsLocal = true
+		list[i].Track.Artists = []userModel.Artist{{Name: fmt.Sprintf("Band %d", i%3)}}
+	}
+
+	for seed := int64(0); seed < 20; seed++ {
+		order, violations := Spread(list, Options{ArtistGap: 2, Seed: seed})
+		if violations != 0 {
+			t.Fatalf("seed %d: %d violations, want none", seed, violations)
+		}
+		for position := 1; position < len(order); position++ {
+			for back := 1; back <= min(2, position); back++ {
+				if order[position]%3 == order[position-back]%3 {
+					t.Fatalf("seed %d: %v puts the same band within 2 tracks", seed, order)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package smart
+
+import (
+	"SpotifySorter/internal/lib/sorter"
+	userModel "SpotifySorter/models"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MaxSources caps the playlists a smart playlist reads from.
+	MaxSources = 50
+	// MaxLimit caps the tracks of a smart playlist.
+	MaxLimit = 10000
+)
+
+var (
+	ErrNoSources      = errors.New("smart playlist has no sources")
+	ErrTooManySources = fmt.Errorf("smart playlist reads from more than %d playlists", MaxSources)
+	ErrInvalidLimit   = fmt.Errorf("limit must be between 0 and %d", MaxLimit)
+	ErrInvalidSort    = errors.New("sort direction must be asc or desc")
+	ErrUnknownFeature = errors.New("unknown audio feature")
+	ErrInvalidRange   = errors.New("range minimum is greater than its maximum")
+)
+
+// Validate checks that rules can be applied: there is a source, every feature
+// and sort key is known and every range is non-empty.
+func Validate(rules *userModel.SmartRules) error {
+	if !rules.Sources.LikedSongs && len(rules.Sources.PlaylistIds) == 0 {
+		return ErrNoSources
+	}
+	if len(rules.Sources.PlaylistIds) > MaxSources {
+		return ErrTooManySources
+	}
+	if rules.Limit < 0 || rules.Limit > MaxLimit {
+		return ErrInvalidLimit
+	}
+
+	ranges := map[string]*userModel.Range{
+		"year":        rules.Filters.Year,
+		"duration_ms": rules.Filters.DurationMs,
+		"popularity":  rules.Filters.Popularity,
+	}
+	for name, r := range rules.Filters.Features {
+		if !sorter.IsFeature(sorter.Key(name)) {
+			return fmt.Errorf("%w: %s", ErrUnknownFeature, name)
+		}
+		ranges[name] = &r
+	}
+
+	for name, r := range ranges {
+		if r != nil && r.Min != nil && r.Max != nil && *r.Min > *r.Max {
+			return fmt.Errorf("%w: %s", ErrInvalidRange, name)
+		}
+	}
+
+	for _, spec := range rules.Sort {
+		if spec.Direction != "" && spec.Direction != sorter.DirectionAsc && spec.Direction != sorter.DirectionDesc {
+			return ErrInvalidSort
+		}
+	}
+
+	// Sorting an empty list still checks every key.
+	if len(rules.Sort) > 0 {
+		if _, err := sorter.OrderWithFeatures(nil, nil, specs(rules)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// NeedsFeatures reports whether applying rules requires audio features.
+func NeedsFeatures(rules *userModel.SmartRules) bool {
+	if len(rules.Filters.Features) > 0 {
+		return true
+	}
+	for _, spec := range rules.Sort {
+		if sorter.IsFeature(sorter.Key(spec.Key)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply selects the items matching the filters of rules, sorts them and cuts
+// them to the limit. features holds audio features by track id; tracks without
+// them never match a feature filter.
+func Apply(items []userModel.PlaylistItem, features map[string]userModel.AudioFeatures, rules *userModel.SmartRules) ([]userModel.PlaylistItem, error) {
+	var matched []userModel.PlaylistItem
+	for i := range items {
+		if matches(&items[i], features, &rules.Filters) {
+			matched = append(matched, items[i])
+		}
+	}
+
+	if len(rules.Sort) > 0 {
+		order, err := sorter.OrderWithFeatures(matched, features, specs(rules))
+		if err != nil {
+			return nil, err
+		}
+
+		sorted := make([]userModel.PlaylistItem, len(order))
+		for i, position := range order {
+			sorted[i] = matched[position]
+		}
+		matched = sorted
+	}
+
+	if rules.Limit > 0 && len(matched) > rules.Limit {
+		matched = matched[:rules.Limit]
+	}
+
+	return matched, nil
+}
+
+func matches(item *userModel.PlaylistItem, features map[string]userModel.AudioFeatures, filters *userModel.SmartFilters) bool {
+	track := &item.Track
+
+	if len(filters.Artists) > 0 && !byArtist(track, filters.Artists) {
+		return false
+	}
+
+	if filters.Year != nil {
+		year, err := strconv.Atoi(track.Album.ReleaseDate[:min(4, len(track.Album.ReleaseDate))])
+		if err != nil || !inRange(float64(year), filters.Year) {
+			return false
+		}
+	}
+
+	if filters.DurationMs != nil && !inRange(float64(track.DurationMs), filters.DurationMs) {
+		return false
+	}
+
+	if filters.Popularity != nil && !inRange(float64(track.Popularity), filters.Popularity) {
+		return false
+	}
+
+	if filters.Explicit != nil && track.Explicit != *filters.Explicit {
+		return false
+	}
+
+	if len(filters.Features) > 0 {
+		f, ok := features[track.Id]
+		if !ok {
+			return false
+		}
+
+		for name, r := range filters.Features {
+			value, ok := sorter.FeatureValue(sorter.Key(name), &f)
+			if !ok || !inRange(value, &r) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func byArtist(track *userModel.Track, artists []string) bool {
+	for _, artist := range track.Artists {
+		for _, want := range artists {
+			if artist.Id == want || strings.EqualFold(artist.Name, want) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func inRange(value float64, r *userModel.Range) bool {
+	return (r.Min == nil || value >= *r.Min) && (r.Max == nil || value <= *r.Max)
+}
+
+func specs(rules *userModel.SmartRules) []sorter.Spec {
+	specs := make([]sorter.Spec, len(rules.Sort))
+	for i, spec := range rules.Sort {
+		specs[i] = sorter.Spec{Key: sorter.Key(spec.Key), Direction: spec.Direction}
+	}
+	return specs
+}
@@ -0,0 +1,246 @@
+package smart
+
+import (
+	"SpotifySorter/internal/lib/sorter"
+	userModel "SpotifySorter/models"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func bound(v float64) *float64 {
+	return &v
+}
+
+func between(min, max float64) *userModel.Range {
+	return &userModel.Range{Min: bound(min), Max: bound(max)}
+}
+
+type track struct {
+	name       string
+	artistId   string
+	artist     string
+	date       string
+	durationMs int
+	popularity int
+	explicit   bool
+}
+
+func items(tracks ...track) []userModel.PlaylistItem {
+	items := make([]userModel.PlaylistItem, len(tracks))
+	for i, t := range tracks {
+		items[i].Track.Id = t.name
+		items[i].Track.Name = t.name
+		items[i].Track.Artists = []userModel.Artist{{Id: t.artistId, Name: t.artist}}
+		items[i].Track.Album.ReleaseDate = t.date
+		items[i].Track.DurationMs = t.durationMs
+		items[i].Track.Popularity = t.popularity
+		items[i].Track.Explicit = t.explicit
+	}
+	return items
+}
+
+func names(items []userModel.PlaylistItem) []string {
+	names := make([]string, len(items))
+	for i, item := range items {
+		names[i] = item.Track.Name
+	}
+	return names
+}
+
+func TestValidate(t *testing.T) {
+	liked := userModel.SmartSources{LikedSongs: true}
+
+	tests := []struct {
+		name  string
+		rules userModel.SmartRules
+		want  error
+	}{
+		{"liked songs", userModel.SmartRules{Sources: liked}, nil},
+		{"playlists", userModel.SmartRules{Sources: userModel.SmartSources{PlaylistIds: []string{"a", "b"}}}, nil},
+		{"liked songs and playlists", userModel.SmartRules{Sources: userModel.SmartSources{LikedSongs: true, PlaylistIds: []string{"a"}}}, nil},
+		{"no sources", userModel.SmartRules{}, ErrNoSources},
+		{"too many sources", userModel.SmartRules{Sources: userModel.SmartSources{PlaylistIds: make([]string, MaxSources+1)}}, ErrTooManySources},
+		{"as many sources as allowed", userModel.SmartRules{Sources: userModel.SmartSources{PlaylistIds: make([]string, MaxSources)}}, nil},
+		{"negative limit", userModel.SmartRules{Sources: liked, Limit: -1}, ErrInvalidLimit},
+		{"limit too large", userModel.SmartRules{Sources: liked, Limit: MaxLimit + 1}, ErrInvalidLimit},
+		{"largest limit", userModel.SmartRules{Sources: liked, Limit: MaxLimit}, nil},
+		{"features", userModel.SmartRules{Sources: liked, Filters: userModel.SmartFilters{
+			Features: map[string]userModel.Range{"energy": *between(0.5, 1), "tempo": {Min: bound(120)}},
+		}}, nil},
+		{"unknown feature", userModel.SmartRules{Sources: liked, Filters: userModel.SmartFilters{
+			Features: map[string]userModel.Range{"groove": *between(0, 1)},
+		}}, ErrUnknownFeature},
+		{"inverted year", userModel.SmartRules{Sources: liked, Filters: userModel.SmartFilters{Year: between(2000, 1990)}}, ErrInvalidRange},
+		{"inverted duration", userModel.SmartRules{Sources: liked, Filters: userModel.SmartFilters{DurationMs: between(300000, 1)}}, ErrInvalidRange},
+		{"inverted popularity", userModel.SmartRules{Sources: liked, Filters: userModel.SmartFilters{Popularity: between(80, 20)}}, ErrInvalidRange},
+		{"inverted feature", userModel.SmartRules{Sources: liked, Filters: userModel.SmartFilters{
+			Features: map[string]userModel.Range{"valence": *between(0.8, 0.2)},
+		}}, ErrInvalidRange},
+		{"single value range", userModel.SmartRules{Sources: liked, Filters: userModel.SmartFilters{Year: between(1997, 1997)}}, nil},
+		{"sort", userModel.SmartRules{Sources: liked, Sort: []userModel.SortSpec{{Key: "popularity", Direction: sorter.DirectionDesc}, {Key: "tempo"}}}, nil},
+		{"bad sort direction", userModel.SmartRules{Sources: liked, Sort: []userModel.SortSpec{{Key: "name", Direction: "up"}}}, ErrInvalidSort},
+		{"unknown sort key", userModel.SmartRules{Sources: liked, Sort: []userModel.SortSpec{{Key: "name"}, {Key: "genre"}}}, sorter.ErrUnknownKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(&tt.rules)
+			if tt.want == nil && err != nil {
+				t.Errorf("Validate: %v", err)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("Validate returned %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNeedsFeatures(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules userModel.SmartRules
+		want  bool
+	}{
+		{"no rules", userModel.SmartRules{}, false},
+		{"track filters and sort", userModel.SmartRules{
+			Filters: userModel.SmartFilters{Year: between(1990, 1999), Popularity: between(50, 100)},
+			Sort:    []userModel.SortSpec{{Key: "popularity"}},
+		}, false},
+		{"feature filter", userModel.SmartRules{Filters: userModel.SmartFilters{
+			Features: map[string]userModel.Range{"energy": {Min: bound(0.5)}},
+		}}, true},
+		{"feature sort", userModel.SmartRules{Sort: []userModel.SortSpec{{Key: "name"}, {Key: "tempo"}}}, true},
+	}
+
+	for _, tt := range tests {
+		if got := NeedsFeatures(&tt.rules); got != tt.want {
+			t.Errorf("NeedsFeatures(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestApplyFilters(t *testing.T) {
+	playlist := items(
+		track{"airbag", "rh", "Radiohead", "1997-05-21", 284000, 70, false},
+		track{"teardrop", "ma", "Massive Attack", "1998", 330000, 80, false},
+		track{"roads", "ph", "Portishead", "1994-08-22", 305000, 60, true},
+		track{"reckoner", "rh", "Radiohead", "2007-10-10", 290000, 75, false},
+		track{"untitled", "", "local band", "", 120000, 0, true},
+	)
+	features := map[string]userModel.AudioFeatures{
+		"airbag":   {Energy: 0.8, Tempo: 140},
+		"teardrop": {Energy: 0.3, Tempo: 77},
+		"roads":    {Energy: 0.2, Tempo: 70},
+		"reckoner": {Energy: 0.5, Tempo: 104},
+	}
+	explicit, clean := true, false
+
+	tests := []struct {
+		name    string
+		filters userModel.SmartFilters
+		want    []string
+	}{
+		{"no filters", userModel.SmartFilters{}, []string{"airbag", "teardrop", "roads", "reckoner", "untitled"}},
+		{"artist id", userModel.SmartFilters{Artists: []string{"rh"}}, []string{"airbag", "reckoner"}},
+		{"artist name", userModel.SmartFilters{Artists: []string{"massive attack", "LOCAL BAND"}}, []string{"teardrop", "untitled"}},
+		{"unknown artist", userModel.SmartFilters{Artists: []string{"Björk"}}, nil},
+		// Tracks without a release date never match a year.
+		{"year", userModel.SmartFilters{Year: between(1994, 1998)}, []string{"airbag", "teardrop", "roads"}},
+		{"year from", userModel.SmartFilters{Year: &userModel.Range{Min: bound(2000)}}, []string{"reckoner"}},
+		{"duration", userModel.SmartFilters{DurationMs: between(280000, 300000)}, []string{"airbag", "reckoner"}},
+		{"duration up to", userModel.SmartFilters{DurationMs: &userModel.Range{Max: bound(200000)}}, []string{"untitled"}},
+		{"popularity", userModel.SmartFilters{Popularity: &userModel.Range{Min: bound(75)}}, []string{"teardrop", "reckoner"}},
+		{"explicit", userModel.SmartFilters{Explicit: &explicit}, []string{"roads", "untitled"}},
+		{"clean", userModel.SmartFilters{Explicit: &clean}, []string{"airbag", "teardrop", "reckoner"}},
+		// The local file has no features, so it never matches a feature filter.
+		{"feature", userModel.SmartFilters{Features: map[string]userModel.Range{"energy": {Max: bound(0.5)}}}, []string{"teardrop", "roads", "reckoner"}},
+		{"open feature range", userModel.SmartFilters{Features: map[string]userModel.Range{"energy": {}}}, []string{"airbag", "teardrop", "roads", "reckoner"}},
+		{"features", userModel.SmartFilters{Features: map[string]userModel.Range{
+			"energy": {Max: bound(0.5)},
+			"tempo":  {Min: bound(75)},
+		}}, []string{"teardrop", "reckoner"}},
+		{"every filter", userModel.SmartFilters{
+			Artists:    []string{"rh", "ma"},
+			Year:       between(1990, 2010),
+			Popularity: &userModel.Range{Max: bound(75)},
+			Explicit:   &clean,
+			Features:   map[string]userModel.Range{"tempo": {Min: bound(100)}},
+		}, []string{"airbag", "reckoner"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := userModel.SmartRules{Filters: tt.filters}
+			got, err := Apply(playlist, features, &rules)
+			if err != nil {
+				t.Fatalf("Apply: %v", err)
+			}
+			if !slices.Equal(names(got), tt.want) {
+				t.Errorf("Apply = %v, want %v", names(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestApplySortAndLimit(t *testing.T) {
+	playlist := items(
+		track{name: "b", popularity: 50},
+		track{name: "d", popularity: 90},
+		track{name: "a", popularity: 70},
+		track{name: "c", popularity: 10},
+	)
+	features := map[string]userModel.AudioFeatures{
+		"a": {Tempo: 120},
+		"b": {Tempo: 90},
+		"d": {Tempo: 100},
+	}
+
+	tests := []struct {
+		name  string
+		sort  []userModel.SortSpec
+		limit int
+		want  []string
+	}{
+		{"unsorted", nil, 0, []string{"b", "d", "a", "c"}},
+		{"unsorted limit", nil, 2, []string{"b", "d"}},
+		{"by name", []userModel.SortSpec{{Key: "name"}}, 0, []string{"a", "b", "c", "d"}},
+		{"by popularity", []userModel.SortSpec{{Key: "popularity", Direction: sorter.DirectionDesc}}, 3, []string{"d", "a", "b"}},
+		// The track without features sorts last.
+		{"by tempo", []userModel.SortSpec{{Key: "tempo"}}, 0, []string{"b", "d", "a", "c"}},
+		{"limit above length", []userModel.SortSpec{{Key: "name"}}, 10, []string{"a", "b", "c", "d"}},
+		{"limit of one", []userModel.SortSpec{{Key: "name", Direction: sorter.DirectionDesc}}, 1, []string{"d"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := userModel.SmartRules{Sort: tt.sort, Limit: tt.limit}
+			got, err := Apply(playlist, features, &rules)
+			if err != nil {
+				t.Fatalf("Apply: %v", err)
+			}
+			if !slices.Equal(names(got), tt.want) {
+				t.Errorf("Apply = %v, want %v", names(got), tt.want)
+			}
+		})
+	}
+
+	// The limit applies after the filters.
+	rules := userModel.SmartRules{
+		Filters: userModel.SmartFilters{Popularity: &userModel.Range{Min: bound(50)}},
+		Sort:    []userModel.SortSpec{{Key: "popularity"}},
+		Limit:   2,
+	}
+	got, err := Apply(playlist, features, &rules)
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if want := []string{"b", "a"}; !slices.Equal(names(got), want) {
+		t.Errorf("filtered Apply = %v, want %v", names(got), want)
+	}
+
+	rules = userModel.SmartRules{Sort: []userModel.SortSpec{{Key: "genre"}}}
+	if _, err := Apply(playlist, features, &rules); !errors.Is(err, sorter.ErrUnknownKey) {
+		t.Errorf("Apply sorted by genre returned %v, want %v", err, sorter.ErrUnknownKey)
+	}
+}
@@ -0,0 +1,46 @@
+package sorter
+
+import userModel "SpotifySorter/models"
+
+const (
+	KeyAcousticness     Key = "acousticness"
+	KeyDanceability     Key = "danceability"
+	KeyEnergy           Key = "energy"
+	KeyInstrumentalness Key = "instrumentalness"
+	KeyMusicalKey       Key = "key"
+	KeyLiveness         Key = "liveness"
+	KeyLoudness         Key = "loudness"
+	KeyMode             Key = "mode"
+	KeySpeechiness      Key = "speechiness"
+	KeyTempo            Key = "tempo"
+	KeyValence          Key = "valence"
+)
+
+var featureValues = map[Key]func(f *userModel.AudioFeatures) float64{
+	KeyAcousticness:     func(f *userModel.AudioFeatures) float64 { return f.Acousticness },
+	KeyDanceability:     func(f *userModel.AudioFeatures) float64 { return f.Danceability },
+	KeyEnergy:           func(f *userModel.AudioFeatures) float64 { return f.Energy },
+	KeyInstrumentalness: func(f *userModel.AudioFeatures) float64 { return f.Instrumentalness },
+	KeyMusicalKey:       func(f *userModel.AudioFeatures) float64 { return float64(f.Key) },
+	KeyLiveness:         func(f *userModel.AudioFeatures) float64 { return f.Liveness },
+	KeyLoudness:         func(f *userModel.AudioFeatures) float64 { return f.Loudness },
+	KeyMode:             func(f *userModel.AudioFeatures) float64 { return float64(f.Mode) },
+	KeySpeechiness:      func(f *userModel.AudioFeatures) float64 { return f.Speechiness },
+	KeyTempo:            func(f *userModel.AudioFeatures) float64 { return f.Tempo },
+	KeyValence:          func(f *userModel.AudioFeatures) float64 { return f.Valence },
+}
+
+// IsFeature reports whether key is an audio feature key.
+func IsFeature(key Key) bool {
+	_, ok := featureValues[key]
+	return ok
+}
+
+// FeatureValue returns the value of the audio feature key in f.
+func FeatureValue(key Key, f *userModel.AudioFeatures) (float64, bool) {
+	value, ok := featureValues[key]
+	if !ok {
+		return 0, false
+	}
+	return value(f), true
+}
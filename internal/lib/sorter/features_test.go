@@ -0,0 +1,106 @@
+package sorter
+
+import (
+	userModel "SpotifySorter/models"
+	"slices"
+	"testing"
+)
+
+func TestOrderWithFeatures(t *testing.T) {
+	playlist := items(
+		track{name: "Slow"},
+		track{name: "Unknown"},
+		track{name: "Fast"},
+		track{name: "Medium"},
+		track{name: "Also unknown"},
+		track{name: "Also medium"},
+	)
+	for i := range playlist {
+		playlist[i].Track.Id = playlist[i].Track.Name
+	}
+
+	features := map[string]userModel.AudioFeatures{
+		"Slow":        {Tempo: 70, Energy: 0.2},
+		"Fast":        {Tempo: 170, Energy: 0.9},
+		"Medium":      {Tempo: 120, Energy: 0.7},
+		"Also medium": {Tempo: 120, Energy: 0.4},
+	}
+
+	tests := []struct {
+		name  string
+		specs []Spec
+		want  []int
+	}{
+		{
+			name:  "missing features sort last ascending",
+			specs: []Spec{{Key: KeyTempo, Direction: DirectionAsc}},
+			want:  []int{0, 3, 5, 2, 1, 4},
+		},
+		{
+			name:  "missing features sort last descending",
+			specs: []Spec{{Key: KeyTempo, Direction: DirectionDesc}},
+			want:  []int{2, 3, 5, 0, 1, 4},
+		},
+		{
+			name: "feature then feature",
+			specs: []Spec{
+				{Key: KeyTempo, Direction: DirectionDesc},
+				{Key: KeyEnergy, Direction: DirectionAsc},
+			},
+			want: []int{2, 5, 3, 0, 1, 4},
+		},
+		{
+			name: "feature then track key",
+			specs: []Spec{
+				{Key: KeyTempo, Direction: DirectionAsc},
+				{Key: KeyName, Direction: DirectionAsc},
+			},
+			want: []int{0, 5, 3, 2, 4, 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := OrderWithFeatures(playlist, features, tt.specs)
+			if err != nil {
+				t.Fatalf("OrderWithFeatures: %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("OrderWithFeatures(%v) = %v, want %v", tt.specs, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFeatureValue(t *testing.T) {
+	f := &userModel.AudioFeatures{Key: 7, Mode: 1, Loudness: -5.5, Valence: 0.25}
+
+	tests := []struct {
+		key  Key
+		want float64
+	}{
+		{KeyMusicalKey, 7},
+		{KeyMode, 1},
+		{KeyLoudness, -5.5},
+		{KeyValence, 0.25},
+		{KeyTempo, 0},
+	}
+
+	for _, tt := range tests {
+		if !IsFeature(tt.key) {
+			t.Errorf("IsFeature(%q) = false, want true", tt.key)
+		}
+		if got, ok := FeatureValue(tt.key, f); !ok || got != tt.want {
+			t.Errorf("FeatureValue(%q) = %v, %v, want %v, true", tt.key, got, ok, tt.want)
+		}
+	}
+
+	for _, key := range []Key{KeyName, KeyPopularity, "bpm"} {
+		if IsFeature(key) {
+			t.Errorf("IsFeature(%q) = true, want false", key)
+		}
+		if _, ok := FeatureValue(key, f); ok {
+			t.Errorf("FeatureValue(%q) succeeded, want false", key)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package sorter
+
+import (
+	userModel "SpotifySorter/models"
+	"cmp"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type Key string
+
+const (
+	KeyName        Key = "name"
+	KeyArtist      Key = "artist"
+	KeyAlbum       Key = "album"
+	KeyReleaseDate Key = "release_date"
+	KeyAddedAt     Key = "added_at"
+	KeyDuration    Key = "duration"
+	KeyPopularity  Key = "popularity"
+	KeyDiscNumber  Key = "disc_number"
+	KeyTrackNumber Key = "track_number"
+)
+
+const (
+	DirectionAsc  = "asc"
+	DirectionDesc = "desc"
+)
+
+var (
+	ErrUnknownKey = errors.New("unknown sort key")
+	ErrNoKeys     = errors.New("no sort keys")
+)
+
+// Spec is a single sort key together with its direction.
+type Spec struct {
+	Key       Key
+	Direction string
+}
+
+type compareFunc func(a, b *userModel.PlaylistItem) int
+
+var comparators = map[Key]compareFunc{
+	KeyName: func(a, b *userModel.PlaylistItem) int {
+		return compareFold(a.Track.Name, b.Track.Name)
+	},
+	KeyArtist: func(a, b *userModel.PlaylistItem) int {
+		return compareFold(primaryArtist(a), primaryArtist(b))
+	},
+	KeyAlbum: func(a, b *userModel.PlaylistItem) int {
+		return compareFold(a.Track.Album.Name, b.Track.Album.Name)
+	},
+	KeyReleaseDate: func(a, b *userModel.PlaylistItem) int {
+		return cmp.Compare(a.Track.Album.ReleaseDate, b.Track.Album.ReleaseDate)
+	},
+	KeyAddedAt: func(a, b *userModel.PlaylistItem) int {
+		return cmp.Compare(a.AddedAt, b.AddedAt)
+	},
+	KeyDuration: func(a, b *userModel.PlaylistItem) int {
+		return cmp.Compare(a.Track.DurationMs, b.Track.DurationMs)
+	},
+	KeyPopularity: func(a, b *userModel.PlaylistItem) int {
+		return cmp.Compare(a.Track.Popularity, b.Track.Popularity)
+	},
+	KeyDiscNumber: func(a, b *userModel.PlaylistItem) int {
+		return cmp.Compare(a.Track.DiscNumber, b.Track.DiscNumber)
+	},
+	KeyTrackNumber: func(a, b *userModel.PlaylistItem) int {
+		return cmp.Compare(a.Track.TrackNumber, b.Track.TrackNumber)
+	},
+}
+
+// Order returns the positions of items in the order they should appear after
+// sorting by key. Items that compare equal keep their current relative order.
+func Order(items []userModel.PlaylistItem, key Key, direction string) ([]int, error) {
+	return OrderBy(items, []Spec{{Key: key, Direction: direction}})
+}
+
+// OrderBy is like Order but sorts by several keys: each key only decides
+// between items that are equal on all keys before it. Items equal on every
+// key keep their current relative order, so the result is deterministic.
+func OrderBy(items []userModel.PlaylistItem, specs []Spec) ([]int, error) {
+	return OrderWithFeatures(items, nil, specs)
+}
+
+// OrderWithFeatures is like OrderBy but also accepts audio feature keys,
+// looked up in features by track id. Items without features sort after all
+// others in either direction.
+func OrderWithFeatures(items []userModel.PlaylistItem, features map[string]userModel.AudioFeatures, specs []Spec) ([]int, error) {
+	if len(specs) == 0 {
+		return nil, ErrNoKeys
+	}
+
+	compares := make([]func(a, b int) int, len(specs))
+	for i, spec := range specs {
+		desc := strings.EqualFold(spec.Direction, DirectionDesc)
+
+		if compare, ok := comparators[spec.Key]; ok {
+			compares[i] = func(a, b int) int {
+				if desc {
+					a, b = b, a
+				}
+				return compare(&items[a], &items[b])
+			}
+			continue
+		}
+
+		if value, ok := featureValues[spec.Key]; ok {
+			compares[i] = func(a, b int) int {
+				fa, okA := features[items[a].Track.Id]
+				fb, okB := features[items[b].Track.Id]
+				switch {
+				case !okA || !okB:
+					return cmp.Compare(boolRank(!okA), boolRank(!okB))
+				case desc:
+					return cmp.Compare(value(&fb), value(&fa))
+				default:
+					return cmp.Compare(value(&fa), value(&fb))
+				}
+			}
+			continue
+		}
+
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, spec.Key)
+	}
+
+	order := make([]int, len(items))
+	for i := range order {
+		order[i] = i
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		for _, compare := range compares {
+			if c := compare(order[i], order[j]); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+
+	return order, nil
+}
+
+func primaryArtist(item *userModel.PlaylistItem) string {
+	if len(item.Track.Artists) == 0 {
+		return ""
+	}
+	return item.Track.Artists[0].Name
+}
+
+func boolRank(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func compareFold(a, b string) int {
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+}
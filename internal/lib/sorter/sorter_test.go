@@ -0,0 +1,155 @@
+package sorter
+
+import (
+	userModel "SpotifySorter/models"
+	"errors"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+type track struct {
+	name       string
+	artist     string
+	date       string
+	popularity int
+}
+
+func items(tracks ...track) []userModel.PlaylistItem {
+	items := make([]userModel.PlaylistItem, len(tracks))
+	for i, t := range tracks {
+		items[i].Track.Name = t.name
+		if t.artist != "" {
+			items[i].Track.Artists = []userModel.Artist{{Name: t.artist}}
+		}
+		items[i].Track.Album.ReleaseDate = t.date
+		items[i].Track.Popularity = t.popularity
+	}
+	return items
+}
+
+func TestOrderBy(t *testing.T) {
+	playlist := items(
+		track{"Karma Police", "Radiohead", "1997-05-21", 80},
+		track{"Teardrop", "Massive Attack", "1998-04-20", 75},
+		track{"airbag", "Radiohead", "1997-05-21", 60},
+		track{"Angel", "Massive Attack", "1998-04-20", 75},
+		track{"Creep", "Radiohead", "1992-09-21", 90},
+		track{"Intro", "", "2000-01-01", 10},
+	)
+
+	tests := []struct {
+		name  string
+		specs []Spec
+		want  []int
+	}{
+		{
+			name:  "name ignores case",
+			specs: []Spec{{Key: KeyName, Direction: DirectionAsc}},
+			want:  []int{2, 3, 4, 5, 0, 1},
+		},
+		{
+			name:  "default direction is ascending",
+			specs: []Spec{{Key: KeyPopularity}},
+			want:  []int{5, 2, 1, 3, 0, 4},
+		},
+		{
+			// Teardrop and Angel tie, so they keep their playlist order.
+			name:  "descending keeps ties in order",
+			specs: []Spec{{Key: KeyPopularity, Direction: DirectionDesc}},
+			want:  []int{4, 0, 1, 3, 2, 5},
+		},
+		{
+			name:  "direction is case-insensitive",
+			specs: []Spec{{Key: KeyPopularity, Direction: "DESC"}},
+			want:  []int{4, 0, 1, 3, 2, 5},
+		},
+		{
+			// A missing artist is an empty name and sorts first.
+			name: "artist then release date descending",
+			specs: []Spec{
+				{Key: KeyArtist, Direction: DirectionAsc},
+				{Key: KeyReleaseDate, Direction: DirectionDesc},
+			},
+			want: []int{5, 1, 3, 0, 2, 4},
+		},
+		{
+			name: "three keys",
+			specs: []Spec{
+				{Key: KeyArtist, Direction: DirectionDesc},
+				{Key: KeyReleaseDate, Direction: DirectionAsc},
+				{Key: KeyName, Direction: DirectionAsc},
+			},
+			want: []int{4, 2, 0, 3, 1, 5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := OrderBy(playlist, tt.specs)
+			if err != nil {
+				t.Fatalf("OrderBy: %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("OrderBy(%v) = %v, want %v", tt.specs, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrderByErrors(t *testing.T) {
+	playlist := items(track{name: "Creep"})
+
+	if _, err := OrderBy(playlist, nil); !errors.Is(err, ErrNoKeys) {
+		t.Errorf("OrderBy without keys returned %v, want %v", err, ErrNoKeys)
+	}
+
+	for _, key := range []Key{"bpm", ""} {
+		if _, err := OrderBy(playlist, []Spec{{Key: key}}); !errors.Is(err, ErrUnknownKey) {
+			t.Errorf("OrderBy by %q returned %v, want %v", key, err, ErrUnknownKey)
+		}
+	}
+}
+
+// TestOrderByStable sorts random playlists with many ties and checks that
+// the order is sorted by every key in turn and that ties keep their
+// playlist order.
+func TestOrderByStable(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	artists := []string{"A", "B", "C"}
+	specs := []Spec{
+		{Key: KeyArtist, Direction: DirectionAsc},
+		{Key: KeyPopularity, Direction: DirectionDesc},
+	}
+
+	for i := 0; i < 200; i++ {
+		tracks := make([]track, rng.IntN(40))
+		for j := range tracks {
+			tracks[j] = track{artist: artists[rng.IntN(len(artists))], popularity: rng.IntN(4)}
+		}
+		playlist := items(tracks...)
+
+		order, err := OrderBy(playlist, specs)
+		if err != nil {
+			t.Fatalf("OrderBy: %v", err)
+		}
+
+		for j := 1; j < len(order); j++ {
+			a, b := tracks[order[j-1]], tracks[order[j]]
+			switch {
+			case a.artist != b.artist:
+				if a.artist > b.artist {
+					t.Fatalf("%v: artist %q sorted before %q", order, a.artist, b.artist)
+				}
+			case a.popularity != b.popularity:
+				if a.popularity < b.popularity {
+					t.Fatalf("%v: popularity %d sorted before %d", order, a.popularity, b.popularity)
+				}
+			default:
+				if order[j-1] > order[j] {
+					t.Fatalf("%v: tied items %d and %d swapped", order, order[j-1], order[j])
+				}
+			}
+		}
+	}
+}
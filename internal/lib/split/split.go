@@ -0,0 +1,116 @@
+package split
+
+import (
+	userModel "SpotifySorter/models"
+	"errors"
+	"sort"
+	"strings"
+)
+
+// Key is a property playlist items are grouped by.
+type Key string
+
+const (
+	KeyDecade     Key = "decade"
+	KeyArtist     Key = "artist"
+	KeyAlbumType  Key = "album_type"
+	KeyExplicit   Key = "explicit"
+	KeyAddedMonth Key = "added_month"
+)
+
+// DefaultTemplate names a split playlist after its source and group.
+const DefaultTemplate = "{source} – {group}"
+
+// unknown names the group of items the key cannot be read from.
+const unknown = "Unknown"
+
+var ErrUnknownKey = errors.New("unknown split key")
+
+// Group is a named set of playlist positions, in playlist order.
+type Group struct {
+	Name      string
+	Positions []int
+}
+
+// ByKey groups items by key. Decades and months are returned in
+// chronological order, other groups in order of first appearance; the
+// Unknown group always comes last.
+func ByKey(items []userModel.PlaylistItem, key Key) ([]Group, error) {
+	name, ok := groupNames[key]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	var groups []Group
+	index := make(map[string]int)
+	for i := range items {
+		n := name(&items[i])
+		if n == "" {
+			n = unknown
+		}
+
+		g, ok := index[n]
+		if !ok {
+			g = len(groups)
+			index[n] = g
+			groups = append(groups, Group{Name: n})
+		}
+		groups[g].Positions = append(groups[g].Positions, i)
+	}
+
+	chronological := key == KeyDecade || key == KeyAddedMonth
+	sort.SliceStable(groups, func(i, j int) bool {
+		if (groups[i].Name == unknown) != (groups[j].Name == unknown) {
+			return groups[j].Name == unknown
+		}
+		return chronological && groups[i].Name < groups[j].Name
+	})
+
+	return groups, nil
+}
+
+// Name fills in the {source} and {group} placeholders of template.
+func Name(template, source, group string) string {
+	return strings.NewReplacer("{source}", source, "{group}", group).Replace(template)
+}
+
+var groupNames = map[Key]func(*userModel.PlaylistItem) string{
+	KeyDecade: func(item *userModel.PlaylistItem) string {
+		// Release dates are "YYYY", "YYYY-MM" or "YYYY-MM-DD".
+		date := item.Track.Album.ReleaseDate
+		if len(date) < 4 || date[:4] == "0000" {
+			return ""
+		}
+		return date[:3] + "0s"
+	},
+	KeyArtist: func(item *userModel.PlaylistItem) string {
+		if len(item.Track.Artists) == 0 {
+			return ""
+		}
+		return item.Track.Artists[0].Name
+	},
+	KeyAlbumType: func(item *userModel.PlaylistItem) string {
+		switch item.Track.Album.AlbumType {
+		case "album":
+			return "Albums"
+		case "single":
+			return "Singles"
+		case "compilation":
+			return "Compilations"
+		}
+		return ""
+	},
+	KeyExplicit: func(item *userModel.PlaylistItem) string {
+		if item.Track.Explicit {
+			return "Explicit"
+		}
+		return "Clean"
+	},
+	KeyAddedMonth: func(item *userModel.PlaylistItem) string {
+		// added_at is an RFC 3339 timestamp; very old items have none.
+		if len(item.AddedAt) < 7 {
+			return ""
+		}
+		return item.AddedAt[:7]
+	},
+}
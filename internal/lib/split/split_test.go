@@ -0,0 +1,122 @@
+package split
+
+import (
+	userModel "SpotifySorter/models"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type track struct {
+	artist    string
+	date      string
+	albumType string
+	explicit  bool
+	addedAt   string
+}
+
+func items(tracks ...track) []userModel.PlaylistItem {
+	items := make([]userModel.PlaylistItem, len(tracks))
+	for i, t := range tracks {
+		if t.artist != "" {
+			items[i].Track.Artists = []userModel.Artist{{Name: t.artist}, {Name: "Featured"}}
+		}
+		items[i].Track.Album.ReleaseDate = t.date
+		items[i].Track.Album.AlbumType = t.albumType
+		items[i].Track.Explicit = t.explicit
+		items[i].AddedAt = t.addedAt
+	}
+	return items
+}
+
+func TestByKey(t *testing.T) {
+	playlist := items(
+		track{"Radiohead", "1997-05-21", "album", false, "2021-03-01T10:00:00Z"},
+		track{"Massive Attack", "1998", "single", true, "2020-11-15T08:30:00Z"},
+		track{"", "", "", false, ""},
+		track{"Radiohead", "2007-10", "compilation", true, "2021-03-20T12:00:00Z"},
+		track{"Portishead", "1994-08-22", "appears_on", false, "2019-01-01T00:00:00Z"},
+		track{"Massive Attack", "0000", "album", false, "2020-11-01T00:00:00Z"},
+	)
+
+	tests := []struct {
+		key  Key
+		want []Group
+	}{
+		{KeyDecade, []Group{
+			{"1990s", []int{0, 1, 4}},
+			{"2000s", []int{3}},
+			{"Unknown", []int{2, 5}},
+		}},
+		{KeyArtist, []Group{
+			{"Radiohead", []int{0, 3}},
+			{"Massive Attack", []int{1, 5}},
+			{"Portishead", []int{4}},
+			{"Unknown", []int{2}},
+		}},
+		{KeyAlbumType, []Group{
+			{"Albums", []int{0, 5}},
+			{"Singles", []int{1}},
+			{"Compilations", []int{3}},
+			{"Unknown", []int{2, 4}},
+		}},
+		{KeyExplicit, []Group{
+			{"Clean", []int{0, 2, 4, 5}},
+			{"Explicit", []int{1, 3}},
+		}},
+		{KeyAddedMonth, []Group{
+			{"2019-01", []int{4}},
+			{"2020-11", []int{1, 5}},
+			{"2021-03", []int{0, 3}},
+			{"Unknown", []int{2}},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.key), func(t *testing.T) {
+			got, err := ByKey(playlist, tt.key)
+			if err != nil {
+				t.Fatalf("ByKey: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ByKey(%s) = %v, want %v", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestByKeyErrors(t *testing.T) {
+	if _, err := ByKey(items(track{}), "genre"); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("ByKey by genre returned %v, want %v", err, ErrUnknownKey)
+	}
+
+	groups, err := ByKey(nil, KeyArtist)
+	if err != nil || len(groups) != 0 {
+		t.Errorf("ByKey of an empty playlist = %v, %v, want no groups", groups, err)
+	}
+}
+
+func TestName(t *testing.T) {
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{DefaultTemplate, "Road Trip – 1990s"},
+		{"{group}", "1990s"},
+		{"{group} from {source}", "1990s from Road Trip"},
+		{"{group}/{group}", "1990s/1990s"},
+		{"{Group} {source", "{Group} {source"},
+		{"Best of {group}", "Best of 1990s"},
+	}
+
+	for _, tt := range tests {
+		if got := Name(tt.template, "Road Trip", "1990s"); got != tt.want {
+			t.Errorf("Name(%q) = %q, want %q", tt.template, got, tt.want)
+		}
+	}
+
+	// Placeholders in the names themselves are not expanded again.
+	if got := Name("{source}: {group}", "{group}", "{source}"); got != "{group}: {source}" {
+		t.Errorf("Name expanded placeholders in the names: %q", got)
+	}
+}
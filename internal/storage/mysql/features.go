@@ -0,0 +1,132 @@
+package mysql
+
+import (
+	userModel "SpotifySorter/models"
+	"fmt"
+	"strings"
+)
+
+// featuresBatch bounds the number of placeholders in a single query.
+const featuresBatch = 500
+
+// GetAudioFeatures returns the cached audio features of the tracks, keyed by
+// track id, and the set of tracks cached as having no features. Tracks that
+// are not cached are missing from both.
+func (s *Storage) GetAudioFeatures(trackIds []string) (map[string]userModel.AudioFeatures, map[string]bool, error) {
+	const op = "storage.mysql.GetAudioFeatures"
+
+	features := make(map[string]userModel.AudioFeatures, len(trackIds))
+	unavailable := make(map[string]bool)
+
+	for start := 0; start < len(trackIds); start += featuresBatch {
+		batch := trackIds[start:min(start+featuresBatch, len(trackIds))]
+
+		args := make([]any, len(batch))
+		for i, id := range batch {
+			args[i] = id
+		}
+
+		rows, err := s.db.Query(`
+            SELECT track_id, acousticness, danceability, energy, instrumentalness, track_key,
+                   liveness, loudness, mode, speechiness, tempo, time_signature, valence, available
+            FROM audio_features
+            WHERE track_id IN (`+placeholders(len(batch))+`)
+        `, args...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		for rows.Next() {
+			var f userModel.AudioFeatures
+			var available bool
+			err := rows.Scan(
+				&f.Id,
+				&f.Acousticness,
+				&f.Danceability,
+				&f.Energy,
+				&f.Instrumentalness,
+				&f.Key,
+				&f.Liveness,
+				&f.Loudness,
+				&f.Mode,
+				&f.Speechiness,
+				&f.Tempo,
+				&f.TimeSignature,
+				&f.Valence,
+				&available,
+			)
+			if err != nil {
+				rows.Close()
+				return nil, nil, fmt.Errorf("%s: %w", op, err)
+			}
+
+			if available {
+				features[f.Id] = f
+			} else {
+				unavailable[f.Id] = true
+			}
+		}
+
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return features, unavailable, nil
+}
+
+// SaveAudioFeatures caches audio features. Features never change, so
+// existing rows are left as they are.
+func (s *Storage) SaveAudioFeatures(features []userModel.AudioFeatures) error {
+	const op = "storage.mysql.SaveAudioFeatures"
+
+	stmt, err := s.db.Prepare(`
+        INSERT IGNORE INTO audio_features(track_id, acousticness, danceability, energy, instrumentalness, track_key,
+                                          liveness, loudness, mode, speechiness, tempo, time_signature, valence)
+        VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+    `)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	for _, f := range features {
+		_, err := stmt.Exec(f.Id, f.Acousticness, f.Danceability, f.Energy, f.Instrumentalness, f.Key,
+			f.Liveness, f.Loudness, f.Mode, f.Speechiness, f.Tempo, f.TimeSignature, f.Valence)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return nil
+}
+
+// SaveUnavailableAudioFeatures caches that Spotify has no audio features for
+// the tracks, so they are not requested again.
+func (s *Storage) SaveUnavailableAudioFeatures(trackIds []string) error {
+	const op = "storage.mysql.SaveUnavailableAudioFeatures"
+
+	stmt, err := s.db.Prepare(`
+        INSERT IGNORE INTO audio_features(track_id, acousticness, danceability, energy, instrumentalness, track_key,
+                                          liveness, loudness, mode, speechiness, tempo, time_signature, valence, available)
+        VALUES(?, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, FALSE)
+    `)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	for _, id := range trackIds {
+		if _, err := stmt.Exec(id); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return nil
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
@@ -1,11 +1,13 @@
 package mysql
 
 import (
+	"SpotifySorter/internal/storage"
 	userModel "SpotifySorter/models"
 	"database/sql"
 	"errors"
 	"fmt"
 	_ "github.com/go-sql-driver/mysql"
+	"time"
 )
 
 type Storage struct {
@@ -23,7 +25,7 @@ type Config struct {
 func Init(cfg Config) (*Storage, error) {
 	const op = "storage.mysql.New"
 
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s",
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true",
 		cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.Database)
 
 	db, err := sql.Open("mysql", dsn)
@@ -35,7 +37,7 @@ func Init(cfg Config) (*Storage, error) {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	stmt, err := db.Prepare(`
+	migrations := []string{`
 		   CREATE TABLE IF NOT EXISTS users (
 			id INT AUTO_INCREMENT PRIMARY KEY,
 			name VARCHAR(255) NOT NULL,
@@ -43,46 +45,170 @@ func Init(cfg Config) (*Storage, error) {
 			spotify_access_token TEXT,
 			country VARCHAR(2),
 			id_spotify VARCHAR(255) UNIQUE NOT NULL,
-			product VARCHAR(20),
-			access_token TEXT);
-	`)
+			product VARCHAR(20));
+	`, `
+		   CREATE TABLE IF NOT EXISTS playlist_snapshots (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			user_id INT NOT NULL,
+			playlist_id VARCHAR(255) NOT NULL,
+			snapshot_id VARCHAR(255) NOT NULL,
+			track_uris MEDIUMTEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			INDEX idx_playlist_snapshots_user_playlist (user_id, playlist_id),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE);
+	`, `
+		   CREATE TABLE IF NOT EXISTS audio_features (
+			track_id VARCHAR(64) PRIMARY KEY,
+			acousticness DOUBLE NOT NULL,
+			danceability DOUBLE NOT NULL,
+			energy DOUBLE NOT NULL,
+			instrumentalness DOUBLE NOT NULL,
+			track_key TINYINT NOT NULL,
+			liveness DOUBLE NOT NULL,
+			loudness DOUBLE NOT NULL,
+			mode TINYINT NOT NULL,
+			speechiness DOUBLE NOT NULL,
+			tempo DOUBLE NOT NULL,
+			time_signature TINYINT NOT NULL,
+			valence DOUBLE NOT NULL,
+			fetched_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP);
+	`, `
+		   CREATE TABLE IF NOT EXISTS smart_playlists (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			user_id INT NOT NULL,
+			name VARCHAR(255) NOT NULL,
+			playlist_id VARCHAR(255) NOT NULL DEFAULT '',
+			rules TEXT NOT NULL,
+			synced_at DATETIME NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			INDEX idx_smart_playlists_user (user_id),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE);
+	`, `
+		   CREATE TABLE IF NOT EXISTS refresh_tokens (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			user_id INT NOT NULL,
+			family_id VARCHAR(64) NOT NULL,
+			token_hash CHAR(64) UNIQUE NOT NULL,
+			expires_at DATETIME NOT NULL,
+			used_at DATETIME NULL,
+			revoked_at DATETIME NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			INDEX idx_refresh_tokens_family (family_id),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE);
+	`, `
+		   CREATE TABLE IF NOT EXISTS sessions (
+			id VARCHAR(64) PRIMARY KEY,
+			user_id INT NOT NULL,
+			device VARCHAR(512) NOT NULL,
+			ip VARCHAR(64) NOT NULL,
+			created_at DATETIME NOT NULL,
+			last_seen_at DATETIME NOT NULL,
+			revoked_at DATETIME NULL,
+			INDEX idx_sessions_user (user_id),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE);
+	`}
+
+	for _, migration := range migrations {
+		stmt, err := db.Prepare(migration)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
 
+		_, err = stmt.Exec()
+		stmt.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	columns := []struct {
+		table, column, definition string
+	}{
+		{"users", "spotify_refresh_token", "TEXT"},
+		{"users", "spotify_token_expires_at", "DATETIME NULL"},
+		{"audio_features", "available", "BOOLEAN NOT NULL DEFAULT TRUE"},
+	}
+
+	for _, c := range columns {
+		if err := addColumn(db, c.table, c.column, c.definition); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return &Storage{db: db}, nil
+}
+
+// addColumn adds a column to an existing table unless it is already there.
+// MySQL has no ADD COLUMN IF NOT EXISTS, so the schema is checked first.
+func addColumn(db *sql.DB, table, column, definition string) error {
+	var count int
+	err := db.QueryRow(`
+        SELECT COUNT(*) FROM information_schema.COLUMNS
+        WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?
+    `, table, column).Scan(&count)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", op, err)
+		return err
+	}
+
+	if count > 0 {
+		return nil
 	}
 
-	_, err = stmt.Exec()
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+const userColumns = `id, name, email, spotify_access_token, country, id_spotify, product,
+        COALESCE(spotify_refresh_token, ''), spotify_token_expires_at`
+
+func scanUser(row *sql.Row) (*userModel.User, error) {
+	var user userModel.User
+	var expiresAt sql.NullTime
+	err := row.Scan(
+		&user.Id,
+		&user.Name,
+		&user.Email,
+		&user.SpotifyAccessToken,
+		&user.Country,
+		&user.IdSpotify,
+		&user.Product,
+		&user.SpotifyRefreshToken,
+		&expiresAt,
+	)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", op, err)
+		return nil, err
 	}
 
-	return &Storage{db: db}, nil
+	user.SpotifyTokenExpiresAt = expiresAt.Time
+
+	return &user, nil
 }
 
-func (s *Storage) SaveUser(email, accessToken, spotifyAccessToken, country, name, idSpotify, product string) (*userModel.User, error) {
+func (s *Storage) SaveUser(email, spotifyAccessToken, country, name, idSpotify, product string) (*userModel.User, error) {
 	const op = "storage.mysql.SaveUser"
 
 	stmt, err := s.db.Prepare(`
-        INSERT INTO users(email, access_token, spotify_access_token, country, name, id_spotify, product)
-        VALUES(?, ?, ?, ?, ?, ?, ?)
+        INSERT INTO users(email, spotify_access_token, country, name, id_spotify, product)
+        VALUES(?, ?, ?, ?, ?, ?)
     `)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
+	defer stmt.Close()
 
-	res, err := stmt.Exec(email, accessToken, spotifyAccessToken, country, name, idSpotify, product)
+	res, err := stmt.Exec(email, spotifyAccessToken, country, name, idSpotify, product)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	_, err = res.LastInsertId()
+	id, err := res.LastInsertId()
 	if err != nil {
 		return nil, fmt.Errorf("%s: failed to get last insert id: %w", op, err)
 	}
 
 	user := &userModel.User{
+		Id:                 id,
 		Email:              email,
-		AccessToken:        accessToken,
 		SpotifyAccessToken: spotifyAccessToken,
 		Country:            country,
 		Name:               name,
@@ -94,23 +220,14 @@ func (s *Storage) SaveUser(email, accessToken, spotifyAccessToken, country, name
 }
 
 func (s *Storage) GetUserByEmail(email string) (*userModel.User, error) {
-	stmt, err := s.db.Prepare(`SELECT * FROM users WHERE email = ?`)
+	stmt, err := s.db.Prepare(`SELECT ` + userColumns + ` FROM users WHERE email = ?`)
 
 	if err != nil {
 		return nil, err
 	}
+	defer stmt.Close()
 
-	var user userModel.User
-	err = stmt.QueryRow(email).Scan(
-		&user.Id,
-		&user.Name,
-		&user.Email,
-		&user.SpotifyAccessToken,
-		&user.Country,
-		&user.IdSpotify,
-		&user.Product,
-		&user.AccessToken,
-	)
+	user, err := scanUser(stmt.QueryRow(email))
 
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -119,57 +236,48 @@ func (s *Storage) GetUserByEmail(email string) (*userModel.User, error) {
 		return nil, err
 	}
 
-	return &user, nil
+	return user, nil
 }
 
-func (s *Storage) GetUserByAccessToken(accessToken string) (*userModel.User, error) {
-	stmt, err := s.db.Prepare(`SELECT * FROM users WHERE access_token = ?`)
+func (s *Storage) GetUserById(id int64) (*userModel.User, error) {
+	const op = "storage.mysql.GetUserById"
 
+	stmt, err := s.db.Prepare(`SELECT ` + userColumns + ` FROM users WHERE id = ?`)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
+	defer stmt.Close()
 
-	var user userModel.User
-	err = stmt.QueryRow(accessToken).Scan(
-		&user.Id,
-		&user.Name,
-		&user.Email,
-		&user.SpotifyAccessToken,
-		&user.Country,
-		&user.IdSpotify,
-		&user.Product,
-		&user.AccessToken,
-	)
-
+	user, err := scanUser(stmt.QueryRow(id))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, sql.ErrNoRows
+			return nil, storage.ErrUserNotFound
 		}
-		return nil, err
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return &user, nil
-
+	return user, nil
 }
 
-func (s *Storage) UpdateAccessTokenUser(accessToken string, userModel *userModel.User) (*userModel.User, error) {
-	const op = "storage.mysql.UpdateAccessTokenUser"
+func (s *Storage) UpdateUser(email, spotifyAccessToken, country, name, idSpotify, product string) (*userModel.User, error) {
+	const op = "storage.mysql.UpdateUser"
 
 	stmt, err := s.db.Prepare(`
         UPDATE users
-        SET access_token = ?
-        WHERE access_token = ?;
+        SET spotify_access_token = ?, country = ?, name = ?, id_spotify = ?, product = ?
+        WHERE email = ?;
     `)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
+	defer stmt.Close()
 
-	_, err = stmt.Exec(accessToken, userModel.AccessToken)
+	_, err = stmt.Exec(spotifyAccessToken, country, name, idSpotify, product, email)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	user, err := s.GetUserByAccessToken(accessToken)
+	user, err := s.GetUserByEmail(email)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
@@ -177,27 +285,27 @@ func (s *Storage) UpdateAccessTokenUser(accessToken string, userModel *userModel
 	return user, nil
 }
 
-func (s *Storage) UpdateUser(email, spotifyAccessToken, country, name, idSpotify, product string) (*userModel.User, error) {
-	const op = "storage.mysql.UpdateUser"
+// UpdateSpotifyTokens stores a new Spotify access token for the user. An empty
+// refreshToken keeps the stored one, as Spotify does not always rotate it.
+func (s *Storage) UpdateSpotifyTokens(userId int64, accessToken, refreshToken string, expiresAt time.Time) error {
+	const op = "storage.mysql.UpdateSpotifyTokens"
 
 	stmt, err := s.db.Prepare(`
         UPDATE users
-        SET spotify_access_token = ?, country = ?, name = ?, id_spotify = ?, product = ?
-        WHERE email = ?;
+        SET spotify_access_token = ?,
+            spotify_refresh_token = COALESCE(NULLIF(?, ''), spotify_refresh_token),
+            spotify_token_expires_at = ?
+        WHERE id = ?;
     `)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", op, err)
-	}
-
-	_, err = stmt.Exec(spotifyAccessToken, country, name, idSpotify, product, email)
-	if err != nil {
-		return nil, fmt.Errorf("%s: %w", op, err)
+		return fmt.Errorf("%s: %w", op, err)
 	}
+	defer stmt.Close()
 
-	user, err := s.GetUserByEmail(email)
+	_, err = stmt.Exec(accessToken, refreshToken, expiresAt, userId)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", op, err)
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	return user, nil
+	return nil
 }
@@ -0,0 +1,210 @@
+package mysql
+
+import (
+	"SpotifySorter/internal/storage"
+	userModel "SpotifySorter/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const sessionColumns = `id, user_id, device, ip, created_at, last_seen_at, revoked_at`
+
+func scanSession(row scanner) (*userModel.Session, error) {
+	var session userModel.Session
+	var revokedAt sql.NullTime
+	err := row.Scan(
+		&session.Id,
+		&session.UserId,
+		&session.Device,
+		&session.Ip,
+		&session.CreatedAt,
+		&session.LastSeenAt,
+		&revokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if revokedAt.Valid {
+		session.RevokedAt = &revokedAt.Time
+	}
+
+	return &session, nil
+}
+
+func (s *Storage) SaveSession(id string, userId int64, device, ip string) (*userModel.Session, error) {
+	const op = "storage.mysql.SaveSession"
+
+	stmt, err := s.db.Prepare(`
+        INSERT INTO sessions(id, user_id, device, ip, created_at, last_seen_at)
+        VALUES(?, ?, ?, ?, ?, ?)
+    `)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	now := time.Now()
+	_, err = stmt.Exec(id, userId, device, ip, now, now)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &userModel.Session{
+		Id:         id,
+		UserId:     userId,
+		Device:     device,
+		Ip:         ip,
+		CreatedAt:  now,
+		LastSeenAt: now,
+	}, nil
+}
+
+func (s *Storage) GetSession(id string) (*userModel.Session, error) {
+	const op = "storage.mysql.GetSession"
+
+	stmt, err := s.db.Prepare(`SELECT ` + sessionColumns + ` FROM sessions WHERE id = ?`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	session, err := scanSession(stmt.QueryRow(id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, storage.ErrSessionNotFound
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return session, nil
+}
+
+// GetSessions returns the user's sessions that can still be refreshed, most
+// recently seen first.
+func (s *Storage) GetSessions(userId int64) ([]userModel.Session, error) {
+	const op = "storage.mysql.GetSessions"
+
+	stmt, err := s.db.Prepare(`
+        SELECT ` + sessionColumns + ` FROM sessions s
+        WHERE user_id = ? AND revoked_at IS NULL AND EXISTS (
+            SELECT 1 FROM refresh_tokens t
+            WHERE t.family_id = s.id AND t.used_at IS NULL AND t.revoked_at IS NULL AND t.expires_at > ?
+        )
+        ORDER BY last_seen_at DESC
+    `)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(userId, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	sessions := []userModel.Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		sessions = append(sessions, *session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return sessions, nil
+}
+
+// TouchSession records that the session was just used from ip.
+func (s *Storage) TouchSession(id, ip string) error {
+	const op = "storage.mysql.TouchSession"
+
+	stmt, err := s.db.Prepare(`
+        UPDATE sessions
+        SET last_seen_at = ?, ip = ?
+        WHERE id = ?
+    `)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(time.Now(), ip, id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// RevokeSession revokes one of the user's sessions together with its
+// refresh tokens. The tokens are revoked even if the session is unknown.
+func (s *Storage) RevokeSession(userId int64, id string) error {
+	const op = "storage.mysql.RevokeSession"
+
+	if err := s.RevokeRefreshTokenFamily(userId, id); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	stmt, err := s.db.Prepare(`
+        UPDATE sessions
+        SET revoked_at = ?
+        WHERE id = ? AND user_id = ? AND revoked_at IS NULL
+    `)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	res, err := stmt.Exec(time.Now(), id, userId)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if affected == 0 {
+		return storage.ErrSessionNotFound
+	}
+
+	return nil
+}
+
+// DeleteExpiredSessions removes the user's expired refresh tokens and the
+// sessions that have none left. Sessions younger than a minute are kept, as
+// their first refresh token may not be saved yet.
+func (s *Storage) DeleteExpiredSessions(userId int64) error {
+	const op = "storage.mysql.DeleteExpiredSessions"
+
+	if err := s.DeleteExpiredRefreshTokens(userId); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	stmt, err := s.db.Prepare(`
+        DELETE FROM sessions
+        WHERE user_id = ? AND created_at < ? AND NOT EXISTS (
+            SELECT 1 FROM refresh_tokens t WHERE t.family_id = sessions.id
+        )
+    `)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(userId, time.Now().Add(-time.Minute))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
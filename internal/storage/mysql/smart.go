@@ -0,0 +1,228 @@
+package mysql
+
+import (
+	"SpotifySorter/internal/storage"
+	userModel "SpotifySorter/models"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const smartColumns = `id, user_id, name, playlist_id, rules, synced_at, created_at`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSmartPlaylist(row scanner) (*userModel.SmartPlaylist, error) {
+	var smart userModel.SmartPlaylist
+	var rules string
+	var syncedAt sql.NullTime
+	err := row.Scan(
+		&smart.Id,
+		&smart.UserId,
+		&smart.Name,
+		&smart.PlaylistId,
+		&rules,
+		&syncedAt,
+		&smart.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if syncedAt.Valid {
+		smart.SyncedAt = &syncedAt.Time
+	}
+
+	if err := json.Unmarshal([]byte(rules), &smart.Rules); err != nil {
+		return nil, err
+	}
+
+	return &smart, nil
+}
+
+func (s *Storage) SaveSmartPlaylist(userId int64, name string, rules userModel.SmartRules) (*userModel.SmartPlaylist, error) {
+	const op = "storage.mysql.SaveSmartPlaylist"
+
+	data, err := json.Marshal(rules)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	stmt, err := s.db.Prepare(`
+        INSERT INTO smart_playlists(user_id, name, rules)
+        VALUES(?, ?, ?)
+    `)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	res, err := stmt.Exec(userId, name, string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to get last insert id: %w", op, err)
+	}
+
+	return &userModel.SmartPlaylist{
+		Id:        id,
+		UserId:    userId,
+		Name:      name,
+		Rules:     rules,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+func (s *Storage) GetSmartPlaylists(userId int64) ([]userModel.SmartPlaylist, error) {
+	const op = "storage.mysql.GetSmartPlaylists"
+
+	stmt, err := s.db.Prepare(`SELECT ` + smartColumns + ` FROM smart_playlists WHERE user_id = ? ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	return s.querySmartPlaylists(op, stmt, userId)
+}
+
+// GetSmartPlaylistsSyncedBefore returns the smart playlists of every user that
+// were never synced or last synced before the given time.
+func (s *Storage) GetSmartPlaylistsSyncedBefore(before time.Time) ([]userModel.SmartPlaylist, error) {
+	const op = "storage.mysql.GetSmartPlaylistsSyncedBefore"
+
+	stmt, err := s.db.Prepare(`
+        SELECT ` + smartColumns + ` FROM smart_playlists
+        WHERE synced_at IS NULL OR synced_at < ?
+        ORDER BY synced_at, id
+    `)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	return s.querySmartPlaylists(op, stmt, before)
+}
+
+func (s *Storage) querySmartPlaylists(op string, stmt *sql.Stmt, args ...any) ([]userModel.SmartPlaylist, error) {
+	rows, err := stmt.Query(args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	smarts := []userModel.SmartPlaylist{}
+	for rows.Next() {
+		smart, err := scanSmartPlaylist(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		smarts = append(smarts, *smart)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return smarts, nil
+}
+
+func (s *Storage) GetSmartPlaylist(userId, id int64) (*userModel.SmartPlaylist, error) {
+	const op = "storage.mysql.GetSmartPlaylist"
+
+	stmt, err := s.db.Prepare(`SELECT ` + smartColumns + ` FROM smart_playlists WHERE user_id = ? AND id = ?`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	smart, err := scanSmartPlaylist(stmt.QueryRow(userId, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, storage.ErrSmartNotFound
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return smart, nil
+}
+
+func (s *Storage) UpdateSmartPlaylist(userId, id int64, name string, rules userModel.SmartRules) error {
+	const op = "storage.mysql.UpdateSmartPlaylist"
+
+	data, err := json.Marshal(rules)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	stmt, err := s.db.Prepare(`
+        UPDATE smart_playlists
+        SET name = ?, rules = ?
+        WHERE user_id = ? AND id = ?;
+    `)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(name, string(data), userId, id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) DeleteSmartPlaylist(userId, id int64) error {
+	const op = "storage.mysql.DeleteSmartPlaylist"
+
+	stmt, err := s.db.Prepare(`DELETE FROM smart_playlists WHERE user_id = ? AND id = ?`)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	res, err := stmt.Exec(userId, id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return storage.ErrSmartNotFound
+	}
+
+	return nil
+}
+
+// SetSmartPlaylistSynced records that the smart playlist was materialized
+// into the Spotify playlist playlistId.
+func (s *Storage) SetSmartPlaylistSynced(id int64, playlistId string, syncedAt time.Time) error {
+	const op = "storage.mysql.SetSmartPlaylistSynced"
+
+	stmt, err := s.db.Prepare(`
+        UPDATE smart_playlists
+        SET playlist_id = ?, synced_at = ?
+        WHERE id = ?;
+    `)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(playlistId, syncedAt, id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+package mysql
+
+import (
+	"SpotifySorter/internal/storage"
+	userModel "SpotifySorter/models"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+func (s *Storage) SavePlaylistSnapshot(userId int64, playlistId, snapshotId string, trackUris []string) (*userModel.PlaylistSnapshot, error) {
+	const op = "storage.mysql.SavePlaylistSnapshot"
+
+	uris, err := json.Marshal(trackUris)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	stmt, err := s.db.Prepare(`
+        INSERT INTO playlist_snapshots(user_id, playlist_id, snapshot_id, track_uris)
+        VALUES(?, ?, ?, ?)
+    `)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	res, err := stmt.Exec(userId, playlistId, snapshotId, string(uris))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to get last insert id: %w", op, err)
+	}
+
+	return &userModel.PlaylistSnapshot{
+		Id:         id,
+		UserId:     userId,
+		PlaylistId: playlistId,
+		SnapshotId: snapshotId,
+		TrackUris:  trackUris,
+		CreatedAt:  time.Now(),
+	}, nil
+}
+
+// GetPlaylistSnapshots returns the user's snapshots of the playlist, newest
+// first. Track URIs are not loaded.
+func (s *Storage) GetPlaylistSnapshots(userId int64, playlistId string) ([]userModel.PlaylistSnapshot, error) {
+	const op = "storage.mysql.GetPlaylistSnapshots"
+
+	stmt, err := s.db.Prepare(`
+        SELECT id, user_id, playlist_id, snapshot_id, created_at
+        FROM playlist_snapshots
+        WHERE user_id = ? AND playlist_id = ?
+        ORDER BY created_at DESC, id DESC
+    `)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(userId, playlistId)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	snapshots := []userModel.PlaylistSnapshot{}
+	for rows.Next() {
+		var snapshot userModel.PlaylistSnapshot
+		err := rows.Scan(
+			&snapshot.Id,
+			&snapshot.UserId,
+			&snapshot.PlaylistId,
+			&snapshot.SnapshotId,
+			&snapshot.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return snapshots, nil
+}
+
+func (s *Storage) GetPlaylistSnapshot(userId, id int64) (*userModel.PlaylistSnapshot, error) {
+	const op = "storage.mysql.GetPlaylistSnapshot"
+
+	stmt, err := s.db.Prepare(`
+        SELECT id, user_id, playlist_id, snapshot_id, track_uris, created_at
+        FROM playlist_snapshots
+        WHERE user_id = ? AND id = ?
+    `)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	var snapshot userModel.PlaylistSnapshot
+	var uris string
+	err = stmt.QueryRow(userId, id).Scan(
+		&snapshot.Id,
+		&snapshot.UserId,
+		&snapshot.PlaylistId,
+		&snapshot.SnapshotId,
+		&uris,
+		&snapshot.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, storage.ErrSnapshotNotFound
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := json.Unmarshal([]byte(uris), &snapshot.TrackUris); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &snapshot, nil
+}
@@ -0,0 +1,142 @@
+package mysql
+
+import (
+	"SpotifySorter/internal/storage"
+	userModel "SpotifySorter/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+func (s *Storage) SaveRefreshToken(userId int64, familyId, tokenHash string, expiresAt time.Time) error {
+	const op = "storage.mysql.SaveRefreshToken"
+
+	stmt, err := s.db.Prepare(`
+        INSERT INTO refresh_tokens(user_id, family_id, token_hash, expires_at)
+        VALUES(?, ?, ?, ?)
+    `)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(userId, familyId, tokenHash, expiresAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) GetRefreshToken(tokenHash string) (*userModel.RefreshToken, error) {
+	const op = "storage.mysql.GetRefreshToken"
+
+	stmt, err := s.db.Prepare(`
+        SELECT id, user_id, family_id, expires_at, used_at, revoked_at
+        FROM refresh_tokens WHERE token_hash = ?
+    `)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	var token userModel.RefreshToken
+	var usedAt, revokedAt sql.NullTime
+	err = stmt.QueryRow(tokenHash).Scan(
+		&token.Id,
+		&token.UserId,
+		&token.FamilyId,
+		&token.ExpiresAt,
+		&usedAt,
+		&revokedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, storage.ErrTokenNotFound
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if usedAt.Valid {
+		token.UsedAt = &usedAt.Time
+	}
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+
+	return &token, nil
+}
+
+// UseRefreshToken marks a refresh token as used. It reports false if the
+// token was already used or revoked, so two concurrent refreshes with the
+// same token cannot both succeed.
+func (s *Storage) UseRefreshToken(id int64) (bool, error) {
+	const op = "storage.mysql.UseRefreshToken"
+
+	stmt, err := s.db.Prepare(`
+        UPDATE refresh_tokens
+        SET used_at = ?
+        WHERE id = ? AND used_at IS NULL AND revoked_at IS NULL
+    `)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	res, err := stmt.Exec(time.Now(), id)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return affected == 1, nil
+}
+
+// RevokeRefreshTokenFamily revokes every token of one of the user's families.
+func (s *Storage) RevokeRefreshTokenFamily(userId int64, familyId string) error {
+	const op = "storage.mysql.RevokeRefreshTokenFamily"
+
+	stmt, err := s.db.Prepare(`
+        UPDATE refresh_tokens
+        SET revoked_at = ?
+        WHERE family_id = ? AND user_id = ? AND revoked_at IS NULL
+    `)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(time.Now(), familyId, userId)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// DeleteExpiredRefreshTokens removes the user's tokens that can no longer be
+// used to refresh.
+func (s *Storage) DeleteExpiredRefreshTokens(userId int64) error {
+	const op = "storage.mysql.DeleteExpiredRefreshTokens"
+
+	stmt, err := s.db.Prepare(`
+        DELETE FROM refresh_tokens
+        WHERE user_id = ? AND expires_at < ?
+    `)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(userId, time.Now())
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
@@ -3,5 +3,9 @@ package storage
 import "errors"
 
 var (
-	ErrUserNotFound = errors.New("user not found")
+	ErrUserNotFound     = errors.New("user not found")
+	ErrSnapshotNotFound = errors.New("snapshot not found")
+	ErrSmartNotFound    = errors.New("smart playlist not found")
+	ErrTokenNotFound    = errors.New("refresh token not found")
+	ErrSessionNotFound  = errors.New("session not found")
 )
@@ -0,0 +1,138 @@
+package user
+
+type ExternalUrls struct {
+	Spotify string `json:"spotify"`
+}
+
+type Image struct {
+	Url    string `json:"url"`
+	Height int    `json:"height"`
+	Width  int    `json:"width"`
+}
+
+type Restrictions struct {
+	Reason string `json:"reason"`
+}
+
+type Artist struct {
+	ExternalUrls ExternalUrls `json:"external_urls"`
+	Href         string       `json:"href"`
+	Id           string       `json:"id"`
+	Name         string       `json:"name"`
+	Type         string       `json:"type"`
+	Uri          string       `json:"uri"`
+}
+
+type Album struct {
+	AlbumType            string       `json:"album_type"`
+	TotalTracks          int          `json:"total_tracks"`
+	AvailableMarkets     []string     `json:"available_markets"`
+	ExternalUrls         ExternalUrls `json:"external_urls"`
+	Href                 string       `json:"href"`
+	Id                   string       `json:"id"`
+	Images               []Image      `json:"images"`
+	Name                 string       `json:"name"`
+	ReleaseDate          string       `json:"release_date"`
+	ReleaseDatePrecision string       `json:"release_date_precision"`
+	Restrictions         Restrictions `json:"restrictions"`
+	Type                 string       `json:"type"`
+	Uri                  string       `json:"uri"`
+	Artists              []Artist     `json:"artists"`
+}
+
+type Track struct {
+	Album            Album    `json:"album"`
+	Artists          []Artist `json:"artists"`
+	AvailableMarkets []string `json:"available_markets"`
+	DiscNumber       int      `json:"disc_number"`
+	DurationMs       int      `json:"duration_ms"`
+	Explicit         bool     `json:"explicit"`
+	ExternalIds      struct {
+		Isrc string `json:"isrc"`
+		Ean  string `json:"ean"`
+		Upc  string `json:"upc"`
+	} `json:"external_ids"`
+	ExternalUrls ExternalUrls `json:"external_urls"`
+	Href         string       `json:"href"`
+	Id           string       `json:"id"`
+	IsPlayable   bool         `json:"is_playable"`
+	LinkedFrom   struct {
+	} `json:"linked_from"`
+	Restrictions Restrictions `json:"restrictions"`
+	Name         string       `json:"name"`
+	Popularity   int          `json:"popularity"`
+	PreviewUrl   string       `json:"preview_url"`
+	TrackNumber  int          `json:"track_number"`
+	Type         string       `json:"type"`
+	Uri          string       `json:"uri"`
+	IsLocal      bool         `json:"is_local"`
+}
+
+type PlaylistItem struct {
+	AddedAt string `json:"added_at"`
+	AddedBy struct {
+		ExternalUrls ExternalUrls `json:"external_urls"`
+		Followers    struct {
+			Href  string `json:"href"`
+			Total int    `json:"total"`
+		} `json:"followers"`
+		Href string `json:"href"`
+		Id   string `json:"id"`
+		Type string `json:"type"`
+		Uri  string `json:"uri"`
+	} `json:"added_by"`
+	IsLocal bool  `json:"is_local"`
+	Track   Track `json:"track"`
+}
+
+type Playlist struct {
+	Collaborative bool         `json:"collaborative"`
+	Description   string       `json:"description"`
+	ExternalUrls  ExternalUrls `json:"external_urls"`
+	Href          string       `json:"href"`
+	Id            string       `json:"id"`
+	Images        []Image      `json:"images"`
+	Name          string       `json:"name"`
+	Owner         struct {
+		ExternalUrls ExternalUrls `json:"external_urls"`
+		Followers    struct {
+			Href  string `json:"href"`
+			Total int    `json:"total"`
+		} `json:"followers"`
+		Href        string `json:"href"`
+		Id          string `json:"id"`
+		Type        string `json:"type"`
+		Uri         string `json:"uri"`
+		DisplayName string `json:"display_name"`
+	} `json:"owner"`
+	Public     bool   `json:"public"`
+	SnapshotId string `json:"snapshot_id"`
+	Tracks     struct {
+		Href  string `json:"href"`
+		Total int    `json:"total"`
+	} `json:"tracks"`
+	Type string `json:"type"`
+	Uri  string `json:"uri"`
+}
+
+// Page is a single page of a paged Web API collection.
+type Page[T any] struct {
+	Href     string `json:"href"`
+	Limit    int    `json:"limit"`
+	Next     string `json:"next"`
+	Offset   int    `json:"offset"`
+	Previous string `json:"previous"`
+	Total    int    `json:"total"`
+	Items    []T    `json:"items"`
+}
+
+type PlaylistTracks = Page[PlaylistItem]
+
+// PlaylistDetails holds the editable attributes of a playlist. Unset fields
+// are left unchanged on update.
+type PlaylistDetails struct {
+	Name          string `json:"name,omitempty"`
+	Public        *bool  `json:"public,omitempty"`
+	Collaborative *bool  `json:"collaborative,omitempty"`
+	Description   string `json:"description,omitempty"`
+}
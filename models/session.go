@@ -0,0 +1,16 @@
+package user
+
+import "time"
+
+// Session is a login on one device. Its id is the family id of the refresh
+// tokens issued to it and the sid claim of its access tokens.
+type Session struct {
+	Id         string     `json:"id"`
+	UserId     int64      `json:"-"`
+	Device     string     `json:"device"`
+	Ip         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	RevokedAt  *time.Time `json:"-"`
+	Current    bool       `json:"current"`
+}
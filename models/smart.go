@@ -0,0 +1,57 @@
+package user
+
+import "time"
+
+// SmartPlaylist is a stored rule set that is materialized into a Spotify
+// playlist. PlaylistId is empty until the first sync.
+type SmartPlaylist struct {
+	Id         int64      `json:"id"`
+	UserId     int64      `json:"-"`
+	Name       string     `json:"name"`
+	PlaylistId string     `json:"playlist_id"`
+	Rules      SmartRules `json:"rules"`
+	SyncedAt   *time.Time `json:"synced_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type SmartRules struct {
+	Sources SmartSources `json:"sources"`
+	Filters SmartFilters `json:"filters"`
+	Sort    []SortSpec   `json:"sort,omitempty"`
+	// Limit caps the number of tracks; 0 means no limit.
+	Limit int `json:"limit,omitempty"`
+}
+
+type SmartSources struct {
+	LikedSongs  bool     `json:"liked_songs"`
+	PlaylistIds []string `json:"playlist_ids,omitempty"`
+}
+
+// SmartFilters select the tracks of a smart playlist. Unset filters match
+// every track.
+type SmartFilters struct {
+	// Artists matches tracks by any of the artists, by id or name.
+	Artists    []string         `json:"artists,omitempty"`
+	Year       *Range           `json:"year,omitempty"`
+	DurationMs *Range           `json:"duration_ms,omitempty"`
+	Popularity *Range           `json:"popularity,omitempty"`
+	Explicit   *bool            `json:"explicit,omitempty"`
+	Features   map[string]Range `json:"features,omitempty"`
+}
+
+// Range is an inclusive range. A nil bound is open.
+type Range struct {
+	Min *float64 `json:"min,omitempty"`
+	Max *float64 `json:"max,omitempty"`
+}
+
+type SortSpec struct {
+	Key       string `json:"key"`
+	Direction string `json:"direction,omitempty"`
+}
+
+// SavedTrack is a track in the user's liked songs.
+type SavedTrack struct {
+	AddedAt string `json:"added_at"`
+	Track   Track  `json:"track"`
+}
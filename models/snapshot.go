@@ -0,0 +1,15 @@
+package user
+
+import "time"
+
+// PlaylistSnapshot records the items of a playlist version. TrackUris holds
+// the URI of every item in playlist order; local files keep their
+// spotify:local URI and unavailable items are empty.
+type PlaylistSnapshot struct {
+	Id         int64     `json:"id"`
+	UserId     int64     `json:"-"`
+	PlaylistId string    `json:"playlist_id"`
+	SnapshotId string    `json:"snapshot_id"`
+	TrackUris  []string  `json:"track_uris,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -0,0 +1,23 @@
+package user
+
+import "time"
+
+// RefreshToken is a stored refresh token. Only the SHA-256 hash of the token
+// is kept. Every refresh replaces the token with a new one of the same
+// family, so a token that is presented after it was used has been replayed.
+type RefreshToken struct {
+	Id        int64
+	UserId    int64
+	FamilyId  string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+}
+
+// Tokens are the API tokens issued at login and refresh. ExpiresIn is the
+// lifetime of the access token in seconds.
+type Tokens struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
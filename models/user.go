@@ -1,16 +1,22 @@
 package user
 
-import "github.com/golang-jwt/jwt/v4"
+import (
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
 
 type User struct {
-	Id                 int64
-	Country            string `json:"country"`
-	Name               string `json:"display_name"`
-	AccessToken        string `json:"access_token,omitempty"`
-	SpotifyAccessToken string `json:"spotify_access_token,omitempty"`
-	Email              string `json:"email"`
-	IdSpotify          string `json:"id"`
-	Product            string `json:"product"`
+	Id                    int64
+	Country               string    `json:"country"`
+	Name                  string    `json:"display_name"`
+	SpotifyAccessToken    string    `json:"spotify_access_token,omitempty"`
+	SpotifyRefreshToken   string    `json:"-"`
+	SpotifyTokenExpiresAt time.Time `json:"-"`
+	Email                 string    `json:"email"`
+	IdSpotify             string    `json:"id"`
+	Product               string    `json:"product"`
 }
 
 type AccessTokensByCode struct {
@@ -22,12 +28,29 @@ type AccessTokensByCode struct {
 }
 
 type Response struct {
-	Name        string `json:"name"`
-	AccessToken string `json:"access_token,omitempty"`
-	Email       string `json:"email"`
-	IdSpotify   string `json:"id"`
+	Name         string `json:"name"`
+	AccessToken  string `json:"access_token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int64  `json:"expires_in,omitempty"`
+	Email        string `json:"email"`
+	IdSpotify    string `json:"id"`
 }
 
+// Issuer and audience of the backend's access tokens.
+const (
+	TokenIssuer   = "SpotifySorter"
+	TokenAudience = "SpotifySorter API"
+)
+
+// Claims are the claims of the backend's access tokens. The subject is the
+// user id, the ID (jti) identifies the individual token and SessionId the
+// session it was issued to.
 type Claims struct {
 	jwt.RegisteredClaims
+	SessionId string `json:"sid"`
+}
+
+// UserId returns the user id in the subject claim.
+func (c *Claims) UserId() (int64, error) {
+	return strconv.ParseInt(c.Subject, 10, 64)
 }